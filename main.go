@@ -16,6 +16,7 @@ func main() {
 		RegisterVolumeSnapshotter("community.openstack.org/openstack", newCinderBlockStore).
 		RegisterVolumeSnapshotter("community.openstack.org/openstack-cinder", newCinderBlockStore).
 		RegisterVolumeSnapshotter("community.openstack.org/openstack-manila", newManilaFSStore).
+		RegisterItemBlockAction("community.openstack.org/cinder-pvc", newCinderItemBlockAction).
 		Serve()
 }
 
@@ -27,6 +28,10 @@ func newCinderBlockStore(logger logrus.FieldLogger) (interface{}, error) {
 	return cinder.NewBlockStore(logger), nil
 }
 
+func newCinderItemBlockAction(logger logrus.FieldLogger) (interface{}, error) {
+	return cinder.NewItemBlockAction(logger)
+}
+
 func newManilaFSStore(logger logrus.FieldLogger) (interface{}, error) {
 	return manila.NewFSStore(logger), nil
 }
@@ -0,0 +1,160 @@
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/backups"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// backupParentKey is a backup metadata key with the parent backup ID of
+	// an incremental backup
+	backupParentKey = "openstack.velero.io/parent-backup"
+	// backupPendingDeletionKey is a backup metadata key marking backups,
+	// which are deleted once their dependent backups are deleted
+	backupPendingDeletionKey = "openstack.velero.io/pending-deletion"
+)
+
+// backupListOpts filters the detailed backups list by a volume ID
+type backupListOpts struct {
+	VolumeID string `q:"volume_id"`
+	Sort     string `q:"sort"`
+}
+
+// ToBackupListDetailQuery formats a backupListOpts into a query string.
+func (opts backupListOpts) ToBackupListDetailQuery() (string, error) {
+	q, err := gophercloud.BuildQueryString(opts)
+	return q.String(), err
+}
+
+// selectParentBackup returns the most recent available backup of the volume,
+// which an incremental backup is based on. Nil is returned, when a full
+// backup must be created, i.e. there is no full backup, the chain has
+// "backupMaxIncrementals" incremental backups or its full backup is older
+// than "backupMaxChainAge".
+func (b *BlockStore) selectParentBackup(logWithFields *logrus.Entry, volumeID string) (*backups.Backup, error) {
+	existingBackups, err := b.getVolumeBackups(logWithFields, volumeID)
+	if err != nil {
+		return nil, err
+	}
+
+	var parent *backups.Backup
+	incrementals := 0
+	for i := range existingBackups {
+		backup := &existingBackups[i]
+		if backup.VolumeID != volumeID || !utils.SliceContains(backupStatuses, backup.Status) {
+			continue
+		}
+		if parent == nil {
+			parent = backup
+		}
+		if backup.IsIncremental {
+			incrementals++
+			continue
+		}
+
+		// the full backup of the chain
+		if b.maxIncrementals > 0 && incrementals >= b.maxIncrementals {
+			logWithFields.Infof("Backup chain of volume %s has %d incremental backups, will run a full backup.", volumeID, incrementals)
+			return nil, nil
+		}
+		if age := time.Since(backup.CreatedAt); b.maxChainAge > 0 && age > time.Duration(b.maxChainAge)*time.Second {
+			logWithFields.Infof("Full backup %s of volume %s is %s old, will run a full backup.", backup.ID, volumeID, age.Round(time.Second))
+			return nil, nil
+		}
+		return parent, nil
+	}
+
+	logWithFields.Infof("No full backup exists yet for volume %s, will first run a full backup.", volumeID)
+	return nil, nil
+}
+
+// backupMetadata returns a copy of the backup metadata
+func backupMetadata(backup *backups.Backup) map[string]string {
+	if backup.Metadata == nil {
+		return map[string]string{}
+	}
+	return utils.Merge(*backup.Metadata)
+}
+
+// markBackupPendingDeletion marks the backup with dependent incremental
+// backups to be deleted together with its last dependent backup
+func (b *BlockStore) markBackupPendingDeletion(logWithFields *logrus.Entry, backup *backups.Backup) error {
+	metadata := backupMetadata(backup)
+	metadata[backupPendingDeletionKey] = "true"
+	_, err := backups.Update(context.TODO(), b.client, backup.ID, backupUpdateOpts{Metadata: metadata}).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to mark backup %v pending deletion: %w", backup.ID, utils.WrapError(err))
+	}
+
+	logWithFields.Info("Backup has dependent backups, marked pending deletion")
+	return nil
+}
+
+// deletePendingBackups deletes backups pending deletion, which have no
+// dependent backups anymore. The deletion cascades up the backup chains, so
+// parents left pending by an interrupted deletion are deleted by the next
+// backup deletion, even when it is a retry of an already deleted backup.
+// The backups are found by the pending deletion metadata, so parents of
+// incremental backups created without the parent backup metadata are
+// deleted as well.
+func (b *BlockStore) deletePendingBackups(logWithFields *logrus.Entry, deletedID string) error {
+	for {
+		pages, err := backups.ListDetail(b.client, backupMetadataListOpts{backupPendingDeletionKey: "true"}).AllPages(context.TODO())
+		if err != nil {
+			return fmt.Errorf("failed to list backups pending deletion: %w", utils.WrapError(err))
+		}
+		allBackups, err := backups.ExtractBackups(pages)
+		if err != nil {
+			return fmt.Errorf("failed to extract backups pending deletion: %w", err)
+		}
+		var pending []backups.Backup
+		for _, backup := range allBackups {
+			// the metadata filter may be ignored by older Cinder versions
+			if backupMetadata(&backup)[backupPendingDeletionKey] == "true" {
+				pending = append(pending, backup)
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		// the parent keeps its dependent backup until the deletion is finished
+		if deletedID != "" {
+			_, err = b.waitForBackupStatus(deletedID, []string{"deleted"}, b.backupTimeout)
+			if err != nil {
+				return fmt.Errorf("backup %v wasn't deleted within the time limit: %w", deletedID, utils.WrapError(err))
+			}
+			deletedID = ""
+		}
+
+		deleted := false
+		for _, backup := range pending {
+			if backup.HasDependentBackups || !utils.SliceContains(backupStatuses, backup.Status) {
+				continue
+			}
+			logWithFields.WithFields(logrus.Fields{
+				"pendingBackupID": backup.ID,
+			}).Info("Deleting backup pending deletion")
+			err = b.ensureBackupDeleted(logWithFields, backup.ID, b.backupTimeout)
+			if err != nil {
+				return fmt.Errorf("failed to delete backup %v pending deletion: %w", backup.ID, err)
+			}
+			if b.recordContainer != "" {
+				err = b.deleteBackupRecord(backup.ID)
+				if err != nil {
+					return err
+				}
+			}
+			deleted = true
+		}
+		if !deleted {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package cinder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteBackupChain(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	// a full backup with an incremental backup
+	chain := map[string]map[string]any{
+		"full": {
+			"id":                    "full",
+			"status":                "available",
+			"has_dependent_backups": true,
+			"metadata":              map[string]string{"velero.io/backup": "daily-1"},
+		},
+		"incr": {
+			"id":       "incr",
+			"status":   "available",
+			"metadata": map[string]string{"velero.io/backup": "daily-2", backupParentKey: "full"},
+		},
+	}
+	var deleted []string
+
+	fakeServer.Mux.HandleFunc("/backups/detail", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		var filter map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(r.URL.Query().Get("metadata")), &filter))
+		var list []map[string]any
+		for _, backup := range chain {
+			if backup["metadata"].(map[string]string)[backupPendingDeletionKey] == filter[backupPendingDeletionKey] {
+				list = append(list, backup)
+			}
+		}
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"backups": list})
+	})
+	fakeServer.Mux.HandleFunc("/backups/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/backups/")
+		backup, ok := chain[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(map[string]any{"backup": backup})
+		case "PUT":
+			var req struct {
+				Backup struct {
+					Metadata map[string]string `json:"metadata"`
+				} `json:"backup"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			assert.NotEmpty(t, req.Backup.Metadata)
+			backup["metadata"] = req.Backup.Metadata
+			json.NewEncoder(w).Encode(map[string]any{"backup": backup})
+		case "DELETE":
+			assert.False(t, backup["has_dependent_backups"] == true, "backups with dependent backups cannot be deleted")
+			delete(chain, id)
+			deleted = append(deleted, id)
+			if id == "incr" {
+				chain["full"]["has_dependent_backups"] = false
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+
+	store := BlockStore{
+		client:        fakeClient.ServiceClient(fakeServer),
+		log:           logrus.New(),
+		config:        map[string]string{"method": "backup"},
+		backupTimeout: 3,
+	}
+
+	// the full backup expires first, but the incremental one depends on it
+	assert.NoError(t, store.deleteBackup("full"))
+	assert.Empty(t, deleted)
+	assert.Equal(t, "true", chain["full"]["metadata"].(map[string]string)[backupPendingDeletionKey])
+	assert.Equal(t, "daily-1", chain["full"]["metadata"].(map[string]string)["velero.io/backup"])
+
+	// the full backup is deleted together with the last dependent backup
+	assert.NoError(t, store.deleteBackup("incr"))
+	assert.Equal(t, []string{"incr", "full"}, deleted)
+
+	// a retried deletion resumes the cascade, when the dependent backup is
+	// already deleted, even for parents without the parent backup metadata
+	chain["old-full"] = map[string]any{
+		"id":       "old-full",
+		"status":   "available",
+		"metadata": map[string]string{backupPendingDeletionKey: "true"},
+	}
+	deleted = nil
+	assert.NoError(t, store.deleteBackup("old-incr"))
+	assert.Equal(t, []string{"old-full"}, deleted)
+}
+
+func TestSelectParentBackup(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	volumeID := "521752a6-acf6-4b2d-bc7a-119f9148cd8c"
+	now := time.Now().UTC()
+	fakeServer.Mux.HandleFunc("/backups/detail", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		assert.Equal(t, volumeID, r.URL.Query().Get("volume_id"))
+		assert.Equal(t, "created_at:desc", r.URL.Query().Get("sort"))
+
+		var list []map[string]any
+		for i, incremental := range []bool{true, false, true, false} {
+			list = append(list, map[string]any{
+				"id":             fmt.Sprintf("b%d", i),
+				"volume_id":      volumeID,
+				"status":         "available",
+				"is_incremental": incremental,
+				"created_at":     now.Add(-time.Duration(i) * 24 * time.Hour).Format("2006-01-02T15:04:05.000000"),
+			})
+		}
+		// a failed backup cannot be a parent
+		list = append([]map[string]any{{"id": "failed", "volume_id": volumeID, "status": "error"}}, list...)
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"backups": list})
+	})
+
+	tests := []struct {
+		name            string
+		maxIncrementals int
+		maxChainAge     int
+		expected        string
+	}{
+		{name: "unlimited chain", expected: "b0"},
+		{name: "incrementals limit not reached", maxIncrementals: 2, expected: "b0"},
+		{name: "incrementals limit reached", maxIncrementals: 1},
+		{name: "recent full backup", maxChainAge: 2 * 24 * 3600, expected: "b0"},
+		{name: "old full backup", maxChainAge: 12 * 3600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := BlockStore{
+				client:          fakeClient.ServiceClient(fakeServer),
+				log:             logrus.New(),
+				maxIncrementals: tt.maxIncrementals,
+				maxChainAge:     tt.maxChainAge,
+			}
+			logWithFields := store.log.WithFields(logrus.Fields{"volumeID": volumeID})
+			parent, err := store.selectParentBackup(logWithFields, volumeID)
+			assert.NoError(t, err)
+			if tt.expected == "" {
+				assert.Nil(t, parent)
+			} else if assert.NotNil(t, parent) {
+				assert.Equal(t, tt.expected, parent.ID)
+			}
+		})
+	}
+}
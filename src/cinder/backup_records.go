@@ -0,0 +1,157 @@
+package cinder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/backups"
+	"github.com/gophercloud/gophercloud/v2/openstack/objectstorage/v1/objects"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// backupRecordDir is a Swift object name prefix of exported Cinder backup
+	// records. Velero reserves the "plugins" directory of the backup storage
+	// location for plugin data, so the records can be stored beside the
+	// Velero backups.
+	backupRecordDir = "plugins/openstack/cinder-backup-records"
+)
+
+// backupUpdateOpts wraps the backup update options into the "backup" key
+// required by Cinder, which gophercloud omits
+type backupUpdateOpts backups.UpdateOpts
+
+func (opts backupUpdateOpts) ToBackupUpdateMap() (map[string]any, error) {
+	return gophercloud.BuildRequestBody(backups.UpdateOpts(opts), "backup")
+}
+
+// backupMetadataListOpts filters backups by metadata on the server side
+// using the Cinder metadata filter
+type backupMetadataListOpts map[string]string
+
+func (opts backupMetadataListOpts) ToBackupListDetailQuery() (string, error) {
+	metadata, err := json.Marshal(map[string]string(opts))
+	if err != nil {
+		return "", err
+	}
+	return "?" + url.Values{"metadata": []string{string(metadata)}}.Encode(), nil
+}
+
+// findBackupByMetadata returns the backup with the metadata key and value or
+// nil, when there is no such backup
+func (b *BlockStore) findBackupByMetadata(key, value string) (*backups.Backup, error) {
+	pages, err := backups.ListDetail(b.client, backupMetadataListOpts{key: value}).AllPages(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups with %v=%v metadata: %w", key, value, utils.WrapError(err))
+	}
+	found, err := backups.ExtractBackups(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract backups with %v=%v metadata: %w", key, value, err)
+	}
+	for _, backup := range found {
+		// the metadata filter may be ignored by older Cinder versions
+		if backup.Metadata != nil && (*backup.Metadata)[key] == value {
+			return &backup, nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *BlockStore) backupRecordName(backupID string) string {
+	return path.Join(b.recordPrefix, backupRecordDir, backupID)
+}
+
+// exportBackupRecord exports the backup record and stores it in the Swift
+// container, so the backup can be imported into a Cinder of another region.
+func (b *BlockStore) exportBackupRecord(logWithFields *logrus.Entry, backupID string) error {
+	record, err := backups.Export(context.TODO(), b.client, backupID).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to export backup %v record: %w", backupID, utils.WrapError(err))
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup %v record: %w", backupID, err)
+	}
+
+	opts := objects.CreateOpts{
+		Content:     bytes.NewReader(data),
+		ContentType: "application/json",
+	}
+	_, err = objects.Create(context.TODO(), b.objClient, b.recordContainer, b.backupRecordName(backupID), opts).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to store backup %v record in %v container: %w", backupID, b.recordContainer, utils.WrapError(err))
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"recordContainer": b.recordContainer,
+		"recordObject":    b.backupRecordName(backupID),
+	}).Info("Backup record was exported")
+	return nil
+}
+
+// importBackupRecord imports the backup record stored in the Swift container,
+// when the backup is unknown to Cinder, and returns the imported backup ID.
+// Cinder keeps the backup ID of the record, so the backup imported by
+// a previous restore is reused and deleted together with the Velero snapshot.
+func (b *BlockStore) importBackupRecord(logWithFields *logrus.Entry, backupID string) (string, error) {
+	_, err := backups.Get(context.TODO(), b.client, backupID).Extract()
+	if err == nil {
+		return backupID, nil
+	}
+	if !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return "", fmt.Errorf("failed to get backup %v from cinder: %w", backupID, utils.WrapError(err))
+	}
+
+	logWithFields.Infof("Backup is unknown to cinder, importing its record from %v container", b.recordContainer)
+	res := objects.Download(context.TODO(), b.objClient, b.recordContainer, b.backupRecordName(backupID), nil)
+	data, err := res.ExtractContent()
+	if err != nil {
+		return "", fmt.Errorf("failed to download backup %v record from %v container: %w", backupID, b.recordContainer, utils.WrapError(err))
+	}
+
+	var record backups.ImportOpts
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal backup %v record: %w", backupID, err)
+	}
+
+	response, err := backups.Import(context.TODO(), b.client, record).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to import backup %v record: %w", backupID, utils.WrapError(err))
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"importedBackupID": response.ID,
+	}).Info("Backup record was imported")
+	return response.ID, nil
+}
+
+// deleteBackupRecord deletes the exported backup record from the Swift container
+func (b *BlockStore) deleteBackupRecord(backupID string) error {
+	_, err := objects.Delete(context.TODO(), b.objClient, b.recordContainer, b.backupRecordName(backupID), nil).Extract()
+	if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return fmt.Errorf("failed to delete backup %v record from %v container: %w", backupID, b.recordContainer, utils.WrapError(err))
+	}
+	return nil
+}
+
+// backupRecordExists returns true, when the exported backup record is stored
+// in the Swift container
+func (b *BlockStore) backupRecordExists(backupID string) (bool, error) {
+	_, err := objects.Get(context.TODO(), b.objClient, b.recordContainer, b.backupRecordName(backupID), nil).Extract()
+	if err != nil {
+		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get backup %v record from %v container: %w", backupID, b.recordContainer, utils.WrapError(err))
+	}
+	return true, nil
+}
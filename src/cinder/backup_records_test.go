@@ -0,0 +1,103 @@
+package cinder
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupRecords(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	backupID := "d32019d3-bc6e-4319-9c1d-6722fc136a22"
+	var stored []byte
+	imports := 0
+	imported := false
+	deleted := false
+
+	fakeServer.Mux.HandleFunc("/backups/"+backupID+"/export_record", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"backup-record": {"backup_service": "cinder.backup.drivers.swift.SwiftBackupDriver", "backup_url": "eyJpZCI6ICJkMzIwMTlkMyJ9"}}`)
+	})
+	fakeServer.Mux.HandleFunc("/backups/"+backupID, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case !imported || deleted:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "GET":
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"backup": {"id": "%s", "status": "available"}}`, backupID)
+		case r.Method == "DELETE":
+			deleted = true
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+	fakeServer.Mux.HandleFunc("/backups/import_record", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		th.TestJSONRequest(t, r, `{"backup-record": {"backup_service": "cinder.backup.drivers.swift.SwiftBackupDriver", "backup_url": "eyJpZCI6ICJkMzIwMTlkMyJ9"}}`)
+		imports++
+		imported = true
+		// Cinder keeps the ID of the imported backup
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"backup": {"id": "%s", "name": "imported"}}`, backupID)
+	})
+	fakeServer.Mux.HandleFunc("/backups/detail", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		th.TestFormValues(t, r, map[string]string{"metadata": fmt.Sprintf(`{"%s":"true"}`, backupPendingDeletionKey)})
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"backups": []}`)
+	})
+	fakeServer.Mux.HandleFunc("/swift/records/", func(w http.ResponseWriter, r *http.Request) {
+		// the records are stored in the plugins directory of the Velero backup storage location
+		assert.Equal(t, "/swift/records/velero/plugins/openstack/cinder-backup-records/"+backupID, r.URL.Path)
+		switch r.Method {
+		case "PUT":
+			stored, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		case "GET":
+			w.Write(stored)
+		case "DELETE":
+			stored = nil
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	objClient := fakeClient.ServiceClient(fakeServer)
+	objClient.Endpoint += "swift/"
+	store := BlockStore{
+		client:          fakeClient.ServiceClient(fakeServer),
+		objClient:       objClient,
+		log:             logrus.New(),
+		recordContainer: "records",
+		recordPrefix:    "velero",
+	}
+	logWithFields := store.log.WithFields(logrus.Fields{"backupID": backupID})
+
+	err := store.exportBackupRecord(logWithFields, backupID)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, stored)
+
+	id, err := store.importBackupRecord(logWithFields, backupID)
+	assert.NoError(t, err)
+	assert.Equal(t, backupID, id)
+
+	// the imported backup is reused
+	id, err = store.importBackupRecord(logWithFields, backupID)
+	assert.NoError(t, err)
+	assert.Equal(t, backupID, id)
+	assert.Equal(t, 1, imports)
+
+	// the imported backup is deleted together with the record
+	err = store.deleteBackup(backupID)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Empty(t, stored)
+}
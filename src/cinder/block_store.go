@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
@@ -22,6 +24,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 )
 
 const (
@@ -29,15 +32,34 @@ const (
 	volumeBackupMicroversion = "3.47"
 	volumeImageMicroversion  = "3.1"
 	defaultDeleteDelay       = "10s"
+	defaultEnforceAZMethod   = "backup"
+	// Cinder CSI topology key of the availability zone
+	csiTopologyKey = "topology.cinder.csi.openstack.org/zone"
+	// a prefix of image properties with the volume metadata and Velero tags,
+	// which are restored as volume metadata
+	imageMetadataPrefix = "openstack.velero.io/metadata/"
 )
 
 var (
+	// a trailing Glance API version of the endpoint override
+	imageVersionRe = regexp.MustCompile(`/v2(\.\d+)?/$`)
 	// a list of supported snapshot methods
 	supportedMethods = []string{
 		"snapshot",
 		"clone",
 		"backup",
 		"image",
+		"snapshot-backup",
+	}
+	// a list of supported disk formats of volume images
+	supportedImageDiskFormats = []string{
+		"raw",
+		"qcow2",
+	}
+	// a list of supported methods to move a volume to another availability zone
+	supportedEnforceAZMethods = []string{
+		"backup",
+		"retype",
 	}
 	// a list of supported Cinder CSI drivers
 	supportedDrivers = []string{
@@ -84,10 +106,15 @@ var (
 	}
 )
 
+// jsonPointerEscaper escapes a JSON pointer reference token (RFC 6901)
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
 // BlockStore is a plugin for containing state for the Cinder Block Storage
 type BlockStore struct {
 	client             *gophercloud.ServiceClient
 	imgClient          *gophercloud.ServiceClient
+	region             string
+	objClient          *gophercloud.ServiceClient
 	provider           *gophercloud.ProviderClient
 	config             map[string]string
 	volumeTimeout      int
@@ -101,11 +128,62 @@ type BlockStore struct {
 	containerName      string
 	log                logrus.FieldLogger
 	backupIncremental  bool
+	imageProtected     bool
+	imageStores        []string
+	imageDiskFormat    string
+	imageCompression   bool
+	exportContainer    string
+	exportSegmentSize  int64
+	exportCompression  bool
+	exportKey          []byte
+	exportClient       *gophercloud.ServiceClient
+	maxIncrementals    int
+	maxChainAge        int
+	availability       gophercloud.Availability
+	trusts             map[string]string
+	trustCache         *utils.TrustCache[*BlockStore]
+	groupSnapshots     bool
+	groupSnapshotKey   string
+	groupType          string
+	groupCache         *groupSnapshotCache
+	groupsSupported    bool
+	kubeClient         kubernetes.Interface
+	enforceAZ          bool
+	enforceAZMethod    string
+	azVolumeTypes      map[string]string
+	recordContainer    string
+	recordPrefix       string
+	methods            map[string]string
+	tierAfter          int
+	tierInterval       int
+	tierOnce           *sync.Once
+	tierTrigger        chan struct{}
+	volumeTypeMap      map[string]string
+	defaultVolumeType  string
+	restoreMinSize     int
+	restoreMultiplier  float64
+	azMap              map[string]string
+	fallbackAZ         string
+	azCache            *utils.AZCache
+	metadataPolicy     metadataPolicy
+	sourceClouds       []string
+	sourceRegion       string
+	sourceCache        *sourceStoreCache
+	volumeTransfer     bool
+	transferProjects   map[string]string
 }
 
 // NewBlockStore instantiates a Cinder Volume Snapshotter.
 func NewBlockStore(log logrus.FieldLogger) *BlockStore {
-	return &BlockStore{log: log}
+	return &BlockStore{
+		log:         log,
+		trustCache:  &utils.TrustCache[*BlockStore]{},
+		groupCache:  &groupSnapshotCache{},
+		tierOnce:    &sync.Once{},
+		tierTrigger: make(chan struct{}, 1),
+		azCache:     &utils.AZCache{},
+		sourceCache: &sourceStoreCache{},
+	}
 }
 
 var _ velerovolumesnapshotter.VolumeSnapshotter = (*BlockStore)(nil)
@@ -119,14 +197,25 @@ func (b *BlockStore) Init(config map[string]string) error {
 	}).Info("BlockStore.Init called")
 	b.config = config
 
+	var err error
+
 	// parse the snapshot method
 	b.config["method"] = utils.GetConf(b.config, "method", "snapshot")
 	if !utils.SliceContains(supportedMethods, b.config["method"]) {
 		return fmt.Errorf("unsupported %q snapshot method, supported methods: %q", b.config["method"], supportedMethods)
 	}
+	// parse the volume type to snapshot method map
+	b.methods, err = utils.ParseMap(utils.GetConf(b.config, "methodByVolumeType", ""))
+	if err != nil {
+		return fmt.Errorf("cannot parse methodByVolumeType config variable: %w", err)
+	}
+	for volumeType, method := range b.methods {
+		if !utils.SliceContains(supportedMethods, method) {
+			return fmt.Errorf("unsupported %q snapshot method for %q volume type, supported methods: %q", method, volumeType, supportedMethods)
+		}
+	}
 
 	// parse timeouts
-	var err error
 	b.volumeTimeout, err = utils.DurationToSeconds(utils.GetConf(b.config, "volumeTimeout", defaultTimeout))
 	if err != nil {
 		return fmt.Errorf("cannot parse time from volumeTimeout config variable: %w", err)
@@ -164,77 +253,595 @@ func (b *BlockStore) Init(config map[string]string) error {
 	if err != nil {
 		return fmt.Errorf("cannot parse backupIncremental config variable: %w", err)
 	}
+	b.imageProtected, err = strconv.ParseBool(utils.GetConf(b.config, "imageProtected", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse imageProtected config variable: %w", err)
+	}
+	b.imageStores = utils.ParseList(utils.GetConf(b.config, "imageStores", ""))
+	b.imageDiskFormat = utils.GetConf(b.config, "imageDiskFormat", "")
+	if b.imageDiskFormat != "" && !utils.SliceContains(supportedImageDiskFormats, b.imageDiskFormat) {
+		return fmt.Errorf("unsupported %q imageDiskFormat, supported formats: %q", b.imageDiskFormat, supportedImageDiskFormats)
+	}
+	b.imageCompression, err = strconv.ParseBool(utils.GetConf(b.config, "imageCompression", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse imageCompression config variable: %w", err)
+	}
+
+	// parse the image export options
+	err = b.parseExportConfig()
+	if err != nil {
+		return err
+	}
+
+	// clouds from clouds.yaml probed for snapshots missing in this cloud
+	b.sourceClouds = utils.ParseList(utils.GetConf(b.config, "sourceClouds", ""))
+	b.sourceRegion = utils.GetConf(b.config, "sourceRegion", "")
+	b.maxIncrementals, err = strconv.Atoi(utils.GetConf(b.config, "backupMaxIncrementals", "0"))
+	if err != nil {
+		return fmt.Errorf("cannot parse backupMaxIncrementals config variable: %w", err)
+	}
+	b.maxChainAge, err = utils.DurationToSeconds(utils.GetConf(b.config, "backupMaxChainAge", "0s"))
+	if err != nil {
+		return fmt.Errorf("cannot parse time from backupMaxChainAge config variable: %w", err)
+	}
+
+	// parse group snapshot options
+	b.groupSnapshots, err = strconv.ParseBool(utils.GetConf(b.config, "groupSnapshots", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse groupSnapshots config variable: %w", err)
+	}
+	b.groupSnapshotKey = utils.GetConf(b.config, "groupSnapshotKey", defaultGroupSnapshotKey)
+	b.groupType = utils.GetConf(b.config, "groupType", "")
+	if b.groupSnapshots {
+		if !b.usesMethod("snapshot") {
+			return fmt.Errorf("group snapshots are not supported by %q snapshot method", b.config["method"])
+		}
+		if b.groupType == "" {
+			return fmt.Errorf("groupType config variable must be set for group snapshots")
+		}
+		if b.kubeClient == nil {
+			b.kubeClient, err = utils.NewKubeClient()
+			if err != nil {
+				return fmt.Errorf("failed to create Kubernetes client for group snapshots: %w", err)
+			}
+		}
+	}
+
+	// parse availability zone enforcement options
+	b.enforceAZ, err = strconv.ParseBool(utils.GetConf(b.config, "enforceAZ", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse enforceAZ config variable: %w", err)
+	}
+	b.enforceAZMethod = utils.GetConf(b.config, "enforceAZMethod", defaultEnforceAZMethod)
+	if !utils.SliceContains(supportedEnforceAZMethods, b.enforceAZMethod) {
+		return fmt.Errorf("unsupported %q enforceAZMethod, supported methods: %q", b.enforceAZMethod, supportedEnforceAZMethods)
+	}
+	b.azVolumeTypes, err = utils.ParseMap(utils.GetConf(b.config, "enforceAZVolumeTypes", ""))
+	if err != nil {
+		return fmt.Errorf("cannot parse enforceAZVolumeTypes config variable: %w", err)
+	}
+	if b.enforceAZ {
+		if !b.usesMethod("snapshot") {
+			return fmt.Errorf("enforceAZ config option is not supported by %q snapshot method", b.config["method"])
+		}
+		if b.enforceAZMethod == "retype" && len(b.azVolumeTypes) == 0 {
+			return fmt.Errorf("enforceAZVolumeTypes config variable must be set for %q enforceAZMethod", b.enforceAZMethod)
+		}
+	}
+
+	// parse snapshot tiering options
+	b.tierAfter, err = utils.DurationToSeconds(utils.GetConf(b.config, "tierAfter", "0s"))
+	if err != nil {
+		return fmt.Errorf("cannot parse time from tierAfter config variable: %w", err)
+	}
+	b.tierInterval, err = utils.DurationToSeconds(utils.GetConf(b.config, "tierInterval", "1h"))
+	if err != nil {
+		return fmt.Errorf("cannot parse time from tierInterval config variable: %w", err)
+	}
+	if b.tierAfter > 0 && b.tierInterval <= 0 {
+		return fmt.Errorf("tierInterval config variable must be positive")
+	}
+	if b.tierAfter > 0 && !b.usesMethod("snapshot") {
+		return fmt.Errorf("tierAfter config option is not supported by %q snapshot method", b.config["method"])
+	}
+
+	// parse restore volume type and size options
+	b.volumeTypeMap, err = utils.ParseMap(utils.GetConf(b.config, "volumeTypeMap", ""))
+	if err != nil {
+		return fmt.Errorf("cannot parse volumeTypeMap config variable: %w", err)
+	}
+	b.defaultVolumeType = utils.GetConf(b.config, "defaultVolumeType", "")
+	b.restoreMinSize, err = strconv.Atoi(utils.GetConf(b.config, "restoreMinSize", "0"))
+	if err != nil {
+		return fmt.Errorf("cannot parse restoreMinSize config variable: %w", err)
+	}
+	b.restoreMultiplier, err = strconv.ParseFloat(utils.GetConf(b.config, "restoreSizeMultiplier", "1"), 64)
+	if err != nil {
+		return fmt.Errorf("cannot parse restoreSizeMultiplier config variable: %w", err)
+	}
+	if b.restoreMultiplier < 1 {
+		return fmt.Errorf("restoreSizeMultiplier config variable must be at least 1")
+	}
+
+	// parse the metadata policy of restored volumes
+	b.metadataPolicy, err = parseMetadataPolicy(b.config)
+	if err != nil {
+		return err
+	}
+
+	// parse restore availability zone options
+	b.azMap, err = utils.ParseMap(utils.GetConf(b.config, "availabilityZoneMap", ""))
+	if err != nil {
+		return fmt.Errorf("cannot parse availabilityZoneMap config variable: %w", err)
+	}
+	b.fallbackAZ = utils.GetConf(b.config, "fallbackAZ", "")
+	if b.fallbackAZ != "" && !utils.SliceContains(utils.SupportedAZFallbacks, b.fallbackAZ) {
+		return fmt.Errorf("unsupported %q fallbackAZ, supported values: %q", b.fallbackAZ, utils.SupportedAZFallbacks)
+	}
 
 	// load optional containerName
 	b.containerName = utils.GetConf(b.config, "containerName", "")
 
+	// load optional Swift container for exported backup records
+	b.recordContainer = utils.GetConf(b.config, "backupRecordContainer", "")
+	b.recordPrefix = utils.GetConf(b.config, "backupRecordPrefix", "")
+	if b.recordContainer != "" && !b.usesBackups() && b.tierAfter == 0 {
+		return fmt.Errorf("backupRecordContainer config option is not supported by %q snapshot method", b.config["method"])
+	}
+
+	// parse the endpoint interface
+	b.availability, err = utils.GetAvailability(b.config)
+	if err != nil {
+		return err
+	}
+
+	// parse the project ID to Keystone trust ID map
+	b.trusts, err = utils.ParseMap(utils.GetConf(b.config, "trusts", ""))
+	if err != nil {
+		return fmt.Errorf("cannot parse trusts config variable: %w", err)
+	}
+
+	// transfer restored volumes into the project of the PV
+	b.volumeTransfer, err = strconv.ParseBool(utils.GetConf(b.config, "volumeTransfer", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse volumeTransfer config variable: %w", err)
+	}
+	b.transferProjects, err = utils.ParseMap(utils.GetConf(b.config, "transferProjects", ""))
+	if err != nil {
+		return fmt.Errorf("cannot parse transferProjects config variable: %w", err)
+	}
+
 	// Authenticate to OpenStack
 	err = utils.Authenticate(&b.provider, "cinder", config, b.log)
 	if err != nil {
-		return fmt.Errorf("failed to authenticate against OpenStack in block storage plugin: %w", err)
+		return fmt.Errorf("failed to authenticate against OpenStack in block storage plugin: %w", utils.WrapError(err))
 	}
 
 	// If we haven't set client before or we use multiple clouds - get new client
 	if b.client == nil || config["cloud"] != "" {
-		region, ok := os.LookupEnv("OS_REGION_NAME")
-		if !ok {
-			if config["region"] != "" {
-				region = config["region"]
-			} else {
-				region = ""
+		err = b.initClients()
+		if err != nil {
+			return err
+		}
+	}
+
+	b.startTiering()
+
+	return nil
+}
+
+// initClients creates the block storage and image service clients using the
+// authenticated provider client
+func (b *BlockStore) initClients() error {
+	region, ok := os.LookupEnv("OS_REGION_NAME")
+	if !ok {
+		if b.config["region"] != "" {
+			region = b.config["region"]
+		} else {
+			region = ""
+		}
+	}
+	return b.initRegionClients(region)
+}
+
+// initRegionClients creates the service clients in the region
+func (b *BlockStore) initRegionClients(region string) error {
+	var err error
+	b.client, err = openstack.NewBlockStorageV3(b.provider, gophercloud.EndpointOpts{
+		Region:       region,
+		Availability: b.availability,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create cinder storage client: %w", utils.WrapError(err))
+	}
+
+	// override the catalog endpoint, e.g. when it is not reachable from the cluster network
+	if endpoint := utils.GetConf(b.config, "cinderEndpointOverride", utils.GetEnv("OS_CINDER_ENDPOINT_OVERRIDE", "")); endpoint != "" {
+		err = utils.OverrideEndpoint(b.client, endpoint)
+		if err != nil {
+			return fmt.Errorf("failed to override cinder storage client endpoint: %w", err)
+		}
+		b.log.WithFields(logrus.Fields{
+			"endpoint": b.client.Endpoint,
+		}).Info("Successfully overrode block storage service client endpoint")
+	}
+
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"endpoint":  b.client.Endpoint,
+		"region":    region,
+		"interface": b.availability,
+	})
+
+	b.region = region
+	err = b.initMethodClients(logWithFields)
+	if err != nil {
+		return err
+	}
+
+	// release group snapshots left behind by previous plugin processes
+	if b.groupsSupported {
+		go func() {
+			err := b.reclaimGroupSnapshots(logWithFields, groupSnapshotEntryTTL)
+			if err != nil {
+				logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to release stale group snapshots: %v", err)
 			}
+		}()
+	}
+
+	logWithFields.Info("Successfully created block storage service client")
+
+	return nil
+}
+
+// overrideImageEndpoint sets the image client endpoint to the endpoint
+// override. A trailing API version is stripped from the override, since the
+// v2 version is appended by the resource base.
+func overrideImageEndpoint(client *gophercloud.ServiceClient, endpoint string) error {
+	err := utils.OverrideEndpoint(client, endpoint)
+	if err != nil {
+		return err
+	}
+	client.Endpoint = imageVersionRe.ReplaceAllString(client.Endpoint, "/")
+	client.ResourceBase = client.Endpoint + "v2/"
+	return nil
+}
+
+// initMethodClients sets the Cinder microversion and creates the clients
+// required by the used snapshot methods
+func (b *BlockStore) initMethodClients(logWithFields logrus.FieldLogger) error {
+	var err error
+
+	// set minimum supported Cinder microversion for group snapshots, backups or images,
+	// the highest one required by the used methods wins
+	var microversion string
+	switch {
+	case b.usesBackups(), b.tierAfter > 0, b.usesMethod("snapshot") && b.enforceAZ && b.enforceAZMethod == "backup":
+		// volumes are also moved to another availability zone using backups
+		microversion = volumeBackupMicroversion
+	case b.usesMethod("snapshot") && b.groupSnapshots:
+		microversion = volumeGroupMicroversion
+	case b.usesMethod("image"):
+		microversion = volumeImageMicroversion
+	}
+	if microversion != "" {
+		err = b.setCinderMicroversion(microversion)
+		if err != nil {
+			return err
 		}
-		b.client, err = openstack.NewBlockStorageV3(b.provider, gophercloud.EndpointOpts{
-			Region: region,
+		logWithFields.Infof("Setting the supported %v microversion", b.client.Microversion)
+	}
+
+	// snapshots of a group snapshot are recognized only with the group
+	// microversion, e.g. when group snapshots are disabled in the meantime
+	if b.usesMethod("snapshot") {
+		b.groupsSupported, err = b.supportsMicroversion(volumeGroupMicroversion)
+		if err != nil {
+			logWithFields.Warningf("Failed to obtain supported Cinder microversions, snapshots of group snapshots are deleted as plain snapshots: %v", err)
+		}
+	}
+
+	if (b.usesBackups() || b.tierAfter > 0) && b.recordContainer != "" {
+		recordRegion := utils.GetConf(b.config, "backupRecordRegion", b.region)
+		b.objClient, err = openstack.NewObjectStorageV1(b.provider, gophercloud.EndpointOpts{
+			Region:       recordRegion,
+			Availability: b.availability,
 		})
 		if err != nil {
-			return fmt.Errorf("failed to create cinder storage client: %w", err)
+			return fmt.Errorf("failed to create swift object storage client: %w", utils.WrapError(err))
 		}
+		logWithFields.WithFields(logrus.Fields{
+			"objectEndpoint": b.objClient.Endpoint,
+			"recordRegion":   recordRegion,
+		}).Info("Successfully created object storage service client")
+	}
 
-		logWithFields := b.log.WithFields(logrus.Fields{
-			"endpoint": b.client.Endpoint,
-			"region":   region,
+	if b.usesMethod("image") {
+		b.imgClient, err = openstack.NewImageV2(b.provider, gophercloud.EndpointOpts{
+			Region:       b.region,
+			Availability: b.availability,
 		})
+		if err != nil {
+			return fmt.Errorf("failed to create glance image client: %w", utils.WrapError(err))
+		}
 
-		// set minimum supported Cinder microversion for backups or images
-		switch b.config["method"] {
-		case "backup":
-			err = b.setCinderMicroversion(volumeBackupMicroversion)
-			if err != nil {
-				return err
-			}
-			logWithFields.Infof("Setting the supported %v microversion", b.client.Microversion)
-		case "image":
-			err = b.setCinderMicroversion(volumeImageMicroversion)
+		if endpoint := utils.GetConf(b.config, "glanceEndpointOverride", utils.GetEnv("OS_GLANCE_ENDPOINT_OVERRIDE", "")); endpoint != "" {
+			err = overrideImageEndpoint(b.imgClient, endpoint)
 			if err != nil {
-				return err
+				return fmt.Errorf("failed to override glance image client endpoint: %w", err)
 			}
-			logWithFields.Infof("Setting the supported %v microversion", b.client.Microversion)
+			logWithFields.WithFields(logrus.Fields{
+				"imageEndpoint": b.imgClient.Endpoint,
+			}).Info("Successfully overrode image service client endpoint")
+		}
 
-			b.imgClient, err = openstack.NewImageV2(b.provider, gophercloud.EndpointOpts{
-				Region: region,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to create glance image client: %w", err)
-			}
+		logWithFields.Info("Successfully created image service client")
+	}
 
-			logWithFields.Info("Successfully created image service client")
+	if b.exportContainer != "" {
+		err = b.initExportClient(logWithFields)
+		if err != nil {
+			return err
 		}
-
-		logWithFields.Info("Successfully created block storage service client")
 	}
 
 	return nil
 }
 
+// withTrust returns a block store, which uses a token scoped to the trust ID.
+// The current block store is returned, when the trust ID matches the default
+// one.
+func (b *BlockStore) withTrust(trustID string) (*BlockStore, error) {
+	if trustID == "" || trustID == b.config["trustID"] {
+		return b, nil
+	}
+
+	return b.trustCache.GetOrCreate(trustID, func() (*BlockStore, error) {
+		t := *b
+		t.provider = nil
+		t.config = utils.Merge(b.config, map[string]string{"trustID": trustID})
+		t.log = b.log.WithField("trustID", trustID)
+		err := utils.Authenticate(&t.provider, "cinder", t.config, t.log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate against OpenStack using %s trust in block storage plugin: %w", trustID, utils.WrapError(err))
+		}
+		err = t.initClients()
+		if err != nil {
+			return nil, err
+		}
+		return &t, nil
+	})
+}
+
+// forVolume returns a block store and a trust ID used to access the volume
+func (b *BlockStore) forVolume(volumeID string) (*BlockStore, string, error) {
+	trustID := b.trustCache.VolumeTrustID(volumeID, b.config["trustID"])
+	t, err := b.withTrust(trustID)
+	return t, trustID, err
+}
+
+// usesMethod returns true, when the snapshot method is used by default or
+// for any volume type
+func (b *BlockStore) usesMethod(method string) bool {
+	if b.config["method"] == method {
+		return true
+	}
+	for _, m := range b.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// usesBackups returns true, when any used snapshot method creates Cinder backups
+func (b *BlockStore) usesBackups() bool {
+	return b.usesMethod("backup") || b.usesMethod("snapshot-backup")
+}
+
+// withMethod returns a block store, which uses the snapshot method. The
+// current block store is returned, when the method matches the default one.
+// Clients are initialized for methods, which are no longer configured, e.g.
+// to restore or delete snapshots created before the method change.
+func (b *BlockStore) withMethod(method string) (*BlockStore, error) {
+	if method == "" || method == b.config["method"] {
+		return b, nil
+	}
+
+	m := *b
+	m.config = utils.Merge(b.config, map[string]string{"method": method})
+	m.log = b.log.WithField("method", method)
+	if !b.usesMethod(method) {
+		client := *b.client
+		m.client = &client
+		err := m.initMethodClients(m.log)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &m, nil
+}
+
+// detectMethod returns the snapshot method of a snapshot ID without the
+// method prefix by probing Cinder and Glance resources. The default method is
+// probed first.
+func (b *BlockStore) detectMethod(snapshotID string) (string, error) {
+	methods := []string{b.config["method"]}
+	for _, method := range supportedMethods {
+		if method != b.config["method"] {
+			methods = append(methods, method)
+		}
+	}
+
+	for _, method := range methods {
+		m, err := b.withMethod(method)
+		if err != nil {
+			b.log.WithFields(utils.ErrorFields(err)).Warningf("Skipping %q snapshot method detection", method)
+			continue
+		}
+		ok, err := m.snapshotExists(snapshotID)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return method, nil
+		}
+	}
+
+	// the resource doesn't exist anymore, use the default method
+	return b.config["method"], nil
+}
+
+// snapshotExists returns true, when the snapshot resource of the current
+// method exists
+func (b *BlockStore) snapshotExists(snapshotID string) (bool, error) {
+	var err error
+	switch b.config["method"] {
+	case "clone":
+		_, err = volumes.Get(context.TODO(), b.client, snapshotID).Extract()
+	case "backup", "snapshot-backup":
+		_, err = backups.Get(context.TODO(), b.client, snapshotID).Extract()
+	case "image":
+		_, err = images.Get(context.TODO(), b.imgClient, snapshotID).Extract()
+	default:
+		_, err = snapshots.Get(context.TODO(), b.client, snapshotID).Extract()
+	}
+	if err != nil {
+		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get %v %v: %w", b.config["method"], snapshotID, utils.WrapError(err))
+	}
+	return true, nil
+}
+
+// forSnapshot returns a block store for the snapshot method and trust ID
+// recorded in the snapshot ID together with the bare snapshot ID
+func (b *BlockStore) forSnapshot(snapshotID string) (*BlockStore, string, string, error) {
+	snapshotID, trustID := utils.SplitTrustID(snapshotID)
+	method, snapshotID := utils.SplitMethod(snapshotID, supportedMethods)
+	t, err := b.withTrust(trustID)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if method == "" {
+		method, err = t.detectMethod(snapshotID)
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	// the snapshot may be converted into a backup by tiering, even when
+	// tiering is disabled in the meantime
+	if method == "snapshot" {
+		backupID, ok, err := t.resolveTieredSnapshot(snapshotID)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if ok {
+			t.log.WithFields(logrus.Fields{
+				"snapshotID": snapshotID,
+				"backupID":   backupID,
+			}).Info("Snapshot was converted into backup, using the backup instead")
+			method, snapshotID = "backup", backupID
+		}
+	}
+
+	m, err := t.withMethod(method)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return m, snapshotID, trustID, nil
+}
+
+// volumeMethod returns the snapshot method configured for the volume type
+func (b *BlockStore) volumeMethod(volumeID string) (string, error) {
+	if len(b.methods) == 0 {
+		return b.config["method"], nil
+	}
+
+	volume, err := volumes.Get(context.TODO(), b.client, volumeID).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, utils.WrapError(err))
+	}
+	if method, ok := b.methods[volume.VolumeType]; ok {
+		return method, nil
+	}
+	return b.config["method"], nil
+}
+
 // CreateVolumeFromSnapshot creates a new volume in the specified
 // availability zone, initialized from the provided snapshot and with the specified type.
 // IOPS is ignored as it is not used in Cinder.
 func (b *BlockStore) CreateVolumeFromSnapshot(snapshotID, volumeType, volumeAZ string, iops *int64) (string, error) {
+	// the snapshot may belong to another cloud, e.g. during a migration
+	if len(b.sourceClouds) > 0 {
+		s, target, sourceID, err := b.forSourceCloud(snapshotID)
+		if err != nil {
+			b.log.WithFields(logrus.Fields{
+				"snapshotID": snapshotID,
+			}).WithFields(utils.ErrorFields(err)).Error("failed to look up snapshot in source clouds")
+			return "", err
+		}
+		if s != nil {
+			imageID, cleanup, err := target.importFromSourceCloud(s, sourceID)
+			if err != nil {
+				return "", err
+			}
+			defer cleanup()
+			// keep the trust, the temporary image is created with it
+			snapshotID = utils.JoinTrustID(utils.JoinMethod("image", imageID), target.config["trustID"])
+		}
+	}
+
+	t, snapshotID, trustID, err := b.forSnapshot(snapshotID)
+	if err != nil {
+		return "", err
+	}
+
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"snapshotID": snapshotID,
+		"volumeType": volumeType,
+	})
+	volumeType, err = t.restoreVolumeType(logWithFields, volumeType)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to resolve volume type of restored volume")
+		return "", err
+	}
+	az, err := t.restoreAZ(logWithFields, snapshotID, volumeAZ)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to resolve availability zone of restored volume")
+		return "", err
+	}
+
+	volumeID, err := t.createVolume(snapshotID, volumeType, az)
+	if volumeID != "" && trustID != "" {
+		b.trustCache.SetVolumeTrustID(volumeID, trustID)
+	}
+	if err != nil {
+		return volumeID, err
+	}
+
+	err = t.recordVolumeAZ(logWithFields.WithField("volumeID", volumeID), volumeID, volumeAZ, az)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to record availability zone of restored volume")
+		return volumeID, err
+	}
+
+	err = t.resizeRestoredVolume(logWithFields.WithField("volumeID", volumeID), volumeID)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to resize restored volume")
+		return volumeID, err
+	}
+
+	return volumeID, nil
+}
+
+func (b *BlockStore) createVolume(snapshotID, volumeType, volumeAZ string) (string, error) {
 	switch b.config["method"] {
 	case "clone":
 		return b.createVolumeFromClone(snapshotID, volumeType, volumeAZ)
-	case "backup":
+	case "backup", "snapshot-backup":
 		return b.createVolumeFromBackup(snapshotID, volumeType, volumeAZ)
 	case "image":
 		return b.createVolumeFromImage(snapshotID, volumeType, volumeAZ)
@@ -258,48 +865,181 @@ func (b *BlockStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ s
 	// Make sure snapshot is in ready state
 	logWithFields.Info("Waiting for snapshot to be in 'available' state")
 
-	snapshot, err := b.waitForSnapshotStatus(snapshotID, snapshotStatuses, b.snapshotTimeout)
+	snapshot, err := b.waitForSnapshotStatus(snapshotID, snapshotStatuses, b.snapshotTimeout)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("snapshot didn't get into 'available' state within the time limit")
+		return "", fmt.Errorf("snapshot %v didn't get into 'available' state within the time limit: %w", snapshotID, utils.WrapError(err))
+	}
+	logWithFields.Info("Snapshot is in 'available' state")
+
+	// get original volume with its metadata
+	originVolume, err := volumes.Get(context.TODO(), b.client, snapshot.VolumeID).Extract()
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get volume from cinder")
+		return "", fmt.Errorf("failed to get volume %v from cinder: %w", snapshot.VolumeID, utils.WrapError(err))
+	}
+
+	// Create Cinder Volume from snapshot (backup)
+	logWithFields.Info("Starting to create volume from snapshot")
+	opts := volumes.CreateOpts{
+		Description:      "Velero backup from snapshot",
+		Name:             volumeName,
+		VolumeType:       volumeType,
+		AvailabilityZone: volumeAZ,
+		SnapshotID:       snapshotID,
+		Metadata:         b.metadataPolicy.apply(originVolume.Metadata),
+	}
+	if b.enforceAZ && volumeAZ != "" && originVolume.AvailabilityZone != volumeAZ {
+		// the snapshot backend may not serve the target AZ, create a volume
+		// in the snapshot AZ and move it to the target AZ later
+		opts.AvailabilityZone = originVolume.AvailabilityZone
+	}
+
+	hintOpts := volumes.SchedulerHintOpts{}
+	volume, err := volumes.Create(context.TODO(), b.client, opts, hintOpts).Extract()
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create volume from snapshot")
+		return "", fmt.Errorf("failed to create volume %v from snapshot %v: %w", volumeName, snapshotID, utils.WrapError(err))
+	}
+
+	volume, err = b.waitForVolumeStatus(volume.ID, volumeStatuses, b.volumeTimeout)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("volume didn't get into 'available' state within the time limit")
+		return volume.ID, fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volume.ID, utils.WrapError(err))
+	}
+
+	if b.enforceAZ && volumeAZ != "" && volume.AvailabilityZone != volumeAZ {
+		volumeID, err := b.changeAZ(logWithFields, volume, volumeAZ)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to move a volume to the target %s availability zone", volumeAZ)
+			return volumeID, fmt.Errorf("failed to move a volume to the target %s availability zone: %w", volumeAZ, utils.WrapError(err))
+		}
+		volume.ID = volumeID
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"volumeID": volume.ID,
+	}).Info("Backup volume was created")
+	return volume.ID, nil
+}
+
+// changeAZ moves the volume to the target availability zone and returns the
+// ID of the moved volume.
+func (b *BlockStore) changeAZ(logWithFields *logrus.Entry, volume *volumes.Volume, volumeAZ string) (string, error) {
+	logWithFields = logWithFields.WithFields(logrus.Fields{
+		"volumeID":        volume.ID,
+		"sourceAZ":        volume.AvailabilityZone,
+		"targetAZ":        volumeAZ,
+		"enforceAZMethod": b.enforceAZMethod,
+	})
+	logWithFields.Info("Moving volume to the target availability zone")
+
+	if b.enforceAZMethod == "retype" {
+		err := b.changeAZByRetype(logWithFields, volume.ID, volumeAZ)
+		if err != nil {
+			// the volume remains in the wrong availability zone
+			if err := b.ensureVolumeDeleted(logWithFields, volume.ID, b.volumeTimeout); err != nil {
+				logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete a %s volume", volume.ID)
+			}
+			return "", err
+		}
+		return volume.ID, nil
+	}
+	return b.changeAZByBackup(logWithFields, volume, volumeAZ)
+}
+
+// changeAZByBackup restores a temporary backup of the volume in the target
+// availability zone, then deletes the temporary backup and the source volume.
+// The new volume is deleted as well, when the move fails.
+func (b *BlockStore) changeAZByBackup(logWithFields *logrus.Entry, volume *volumes.Volume, volumeAZ string) (newVolumeID string, err error) {
+	defer func() {
+		if err != nil && newVolumeID != "" {
+			if err := b.ensureVolumeDeleted(logWithFields, newVolumeID, b.volumeTimeout); err != nil {
+				logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete a %s volume", newVolumeID)
+			}
+			newVolumeID = ""
+		}
+		if err := b.ensureVolumeDeleted(logWithFields, volume.ID, b.volumeTimeout); err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete an intermediate %s volume", volume.ID)
+		}
+	}()
+
+	opts := &backups.CreateOpts{
+		Name:        volume.Name,
+		VolumeID:    volume.ID,
+		Description: "Velero temp backup",
+		Container:   volume.Name,
+		Force:       true,
+	}
+	// Override container if one was passed by the user
+	if b.containerName != "" {
+		opts.Container = b.containerName
+	}
+
+	backup, err := backups.Create(context.TODO(), b.client, opts).Extract()
 	if err != nil {
-		logWithFields.Error("snapshot didn't get into 'available' state within the time limit")
-		return "", fmt.Errorf("snapshot %v didn't get into 'available' state within the time limit: %w", snapshotID, err)
+		return "", fmt.Errorf("failed to create a temporary backup from volume %v: %w", volume.ID, utils.WrapError(err))
 	}
-	logWithFields.Info("Snapshot is in 'available' state")
+	defer func() {
+		if err := b.ensureBackupDeleted(logWithFields, backup.ID, b.backupTimeout); err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete a temporary %s backup", backup.ID)
+		}
+	}()
 
-	// get original volume with its metadata
-	originVolume, err := volumes.Get(context.TODO(), b.client, snapshot.VolumeID).Extract()
+	_, err = b.waitForBackupStatus(backup.ID, backupStatuses, b.backupTimeout)
 	if err != nil {
-		logWithFields.Error("failed to get volume from cinder")
-		return "", fmt.Errorf("failed to get volume %v from cinder: %w", snapshot.VolumeID, err)
+		return "", fmt.Errorf("temporary backup %v didn't get into 'available' state within the time limit: %w", backup.ID, utils.WrapError(err))
 	}
 
-	// Create Cinder Volume from snapshot (backup)
-	logWithFields.Info("Starting to create volume from snapshot")
-	opts := volumes.CreateOpts{
-		Description:      "Velero backup from snapshot",
-		Name:             volumeName,
-		VolumeType:       volumeType,
+	volOpts := volumes.CreateOpts{
+		Description:      volume.Description,
+		Name:             volume.Name,
+		VolumeType:       volume.VolumeType,
 		AvailabilityZone: volumeAZ,
-		SnapshotID:       snapshotID,
-		Metadata:         originVolume.Metadata,
+		BackupID:         backup.ID,
+		Metadata:         volume.Metadata,
+	}
+	newVolume, err := volumes.Create(context.TODO(), b.client, volOpts, volumes.SchedulerHintOpts{}).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to create volume from temporary backup %v: %w", backup.ID, utils.WrapError(err))
 	}
 
-	hintOpts := volumes.SchedulerHintOpts{}
-	volume, err := volumes.Create(context.TODO(), b.client, opts, hintOpts).Extract()
+	_, err = b.waitForVolumeStatus(newVolume.ID, volumeStatuses, b.volumeTimeout)
 	if err != nil {
-		logWithFields.Error("failed to create volume from snapshot")
-		return "", fmt.Errorf("failed to create volume %v from snapshot %v: %w", volumeName, snapshotID, err)
+		return newVolume.ID, fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", newVolume.ID, utils.WrapError(err))
 	}
 
-	_, err = b.waitForVolumeStatus(volume.ID, volumeStatuses, b.volumeTimeout)
+	return newVolume.ID, nil
+}
+
+// changeAZByRetype retypes the volume to a volume type of the target
+// availability zone and lets Cinder migrate it.
+func (b *BlockStore) changeAZByRetype(logWithFields *logrus.Entry, volumeID, volumeAZ string) error {
+	volumeType, ok := b.azVolumeTypes[volumeAZ]
+	if !ok {
+		return fmt.Errorf("enforceAZVolumeTypes has no volume type for %s availability zone", volumeAZ)
+	}
+
+	opts := volumes.ChangeTypeOpts{
+		NewType:         volumeType,
+		MigrationPolicy: volumes.MigrationPolicyOnDemand,
+	}
+	err := volumes.ChangeType(context.TODO(), b.client, volumeID, opts).ExtractErr()
 	if err != nil {
-		logWithFields.Error("volume didn't get into 'available' state within the time limit")
-		return volume.ID, fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volume.ID, err)
+		return fmt.Errorf("failed to retype volume %v to %v volume type: %w", volumeID, volumeType, utils.WrapError(err))
 	}
 
-	logWithFields.WithFields(logrus.Fields{
-		"volumeID": volume.ID,
-	}).Info("Backup volume was created")
-	return volume.ID, nil
+	// Cinder sets the 'retyping' status before accepting the request
+	volume, err := b.waitForVolumeStatus(volumeID, volumeStatuses, b.volumeTimeout)
+	if err != nil {
+		return fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volumeID, utils.WrapError(err))
+	}
+	if volume.AvailabilityZone != volumeAZ {
+		return fmt.Errorf("volume %v was retyped to %v volume type, but remains in %s availability zone", volumeID, volumeType, volume.AvailabilityZone)
+	}
+	logWithFields.Infof("Volume was retyped to %v volume type", volumeType)
+
+	return nil
 }
 
 func (b *BlockStore) createVolumeFromClone(cloneID, volumeType, volumeAZ string) (string, error) {
@@ -339,13 +1079,23 @@ func (b *BlockStore) createVolumeFromBackup(backupID, volumeType, volumeAZ strin
 	logWithFields.Info("BlockStore.CreateVolumeFromSnapshot called")
 
 	volumeName := fmt.Sprintf("%s.backup.%s", backupID, strconv.FormatUint(utils.Rand.Uint64(), 10))
+	// import a backup from another region
+	if b.recordContainer != "" {
+		var err error
+		backupID, err = b.importBackupRecord(logWithFields, backupID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to import backup record")
+			return "", err
+		}
+	}
+
 	// Make sure backup is in ready state
 	logWithFields.Info("Waiting for backup to be in 'available' state")
 
 	backup, err := b.waitForBackupStatus(backupID, backupStatuses, b.backupTimeout)
 	if err != nil {
-		logWithFields.Error("backup didn't get into 'available' state within the time limit")
-		return "", fmt.Errorf("backup %v didn't get into 'available' state within the time limit: %w", backupID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("backup didn't get into 'available' state within the time limit")
+		return "", fmt.Errorf("backup %v didn't get into 'available' state within the time limit: %w", backupID, utils.WrapError(err))
 	}
 	logWithFields.Info("Backup is in 'available' state")
 
@@ -359,20 +1109,20 @@ func (b *BlockStore) createVolumeFromBackup(backupID, volumeType, volumeAZ strin
 		BackupID:         backupID,
 	}
 	if backup.Metadata != nil {
-		opts.Metadata = *backup.Metadata
+		opts.Metadata = b.metadataPolicy.apply(*backup.Metadata)
 	}
 
 	hintOpts := volumes.SchedulerHintOpts{}
 	volume, err := volumes.Create(context.TODO(), b.client, opts, hintOpts).Extract()
 	if err != nil {
-		logWithFields.Error("failed to create volume from backup")
-		return "", fmt.Errorf("failed to create volume %v from backup %v: %w", volumeName, backupID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create volume from backup")
+		return "", fmt.Errorf("failed to create volume %v from backup %v: %w", volumeName, backupID, utils.WrapError(err))
 	}
 
 	_, err = b.waitForVolumeStatus(volume.ID, volumeStatuses, b.volumeTimeout)
 	if err != nil {
-		logWithFields.Error("volume didn't get into 'available' state within the time limit")
-		return volume.ID, fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volume.ID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("volume didn't get into 'available' state within the time limit")
+		return volume.ID, fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volume.ID, utils.WrapError(err))
 	}
 
 	logWithFields.WithFields(logrus.Fields{
@@ -393,13 +1143,31 @@ func (b *BlockStore) createVolumeFromImage(imageID, volumeType, volumeAZ string)
 	logWithFields.Info("BlockStore.CreateVolumeFromSnapshot called")
 
 	volumeName := fmt.Sprintf("%s.image.%s", imageID, strconv.FormatUint(utils.Rand.Uint64(), 10))
+
+	// import the exported image, when it doesn't exist anymore
+	if b.exportContainer != "" {
+		importedID, temporary, err := b.importExportedImage(logWithFields, imageID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to import exported image")
+			return "", err
+		}
+		if temporary {
+			imageID = importedID
+			defer func() {
+				if err := images.Delete(context.TODO(), b.imgClient, imageID).ExtractErr(); err != nil {
+					logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete a temporary %s image", imageID)
+				}
+			}()
+		}
+	}
+
 	// Make sure image is in ready state
 	logWithFields.Info("Waiting for image to be in 'available' state")
 
-	_, err := b.waitForImageStatus(imageID, imageStatuses, b.imageTimeout)
+	image, err := b.waitForImageStatus(imageID, imageStatuses, b.imageTimeout)
 	if err != nil {
-		logWithFields.Error("image didn't get into 'active' state within the time limit")
-		return "", fmt.Errorf("image %v didn't get into 'active' state within the time limit: %w", imageID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("image didn't get into 'active' state within the time limit")
+		return "", fmt.Errorf("image %v didn't get into 'active' state within the time limit: %w", imageID, utils.WrapError(err))
 	}
 	logWithFields.Info("Image is in 'active' state")
 
@@ -411,20 +1179,20 @@ func (b *BlockStore) createVolumeFromImage(imageID, volumeType, volumeAZ string)
 		VolumeType:       volumeType,
 		AvailabilityZone: volumeAZ,
 		ImageID:          imageID,
-		// TODO: add Metadata support
+		Metadata:         b.metadataPolicy.apply(imageVolumeMetadata(image)),
 	}
 
 	hintOpts := volumes.SchedulerHintOpts{}
 	volume, err := volumes.Create(context.TODO(), b.client, opts, hintOpts).Extract()
 	if err != nil {
-		logWithFields.Error("failed to create volume from image")
-		return "", fmt.Errorf("failed to create volume %v from image %v: %w", volumeName, imageID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create volume from image")
+		return "", fmt.Errorf("failed to create volume %v from image %v: %w", volumeName, imageID, utils.WrapError(err))
 	}
 
 	_, err = b.waitForVolumeStatus(volume.ID, volumeStatuses, b.volumeTimeout)
 	if err != nil {
-		logWithFields.Error("volume didn't get into 'available' state within the time limit")
-		return volume.ID, fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volume.ID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("volume didn't get into 'available' state within the time limit")
+		return volume.ID, fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volume.ID, utils.WrapError(err))
 	}
 
 	logWithFields.WithFields(logrus.Fields{
@@ -439,8 +1207,8 @@ func (b *BlockStore) cloneVolume(logWithFields *logrus.Entry, volumeID, volumeNa
 
 	originVolume, err := b.waitForVolumeStatus(volumeID, volumeStatuses, b.volumeTimeout)
 	if err != nil {
-		logWithFields.Error("source volume clone didn't get into 'available' state within the time limit")
-		return "", fmt.Errorf("source volume clone %v didn't get into 'available' state within the time limit: %w", volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("source volume clone didn't get into 'available' state within the time limit")
+		return "", fmt.Errorf("source volume clone %v didn't get into 'available' state within the time limit: %w", volumeID, utils.WrapError(err))
 	}
 	logWithFields.Info("Source volume is in 'available' state")
 
@@ -458,14 +1226,14 @@ func (b *BlockStore) cloneVolume(logWithFields *logrus.Entry, volumeID, volumeNa
 	hintOpts := volumes.SchedulerHintOpts{}
 	volume, err := volumes.Create(context.TODO(), b.client, opts, hintOpts).Extract()
 	if err != nil {
-		logWithFields.Error("failed to create volume from volume clone")
-		return "", fmt.Errorf("failed to create volume %v from volume clone %v: %w", volumeName, volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create volume from volume clone")
+		return "", fmt.Errorf("failed to create volume %v from volume clone %v: %w", volumeName, volumeID, utils.WrapError(err))
 	}
 
 	_, err = b.waitForVolumeStatus(volume.ID, volumeStatuses, b.volumeTimeout)
 	if err != nil {
-		logWithFields.Error("volume didn't get into 'available' state within the time limit")
-		return volume.ID, fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volume.ID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("volume didn't get into 'available' state within the time limit")
+		return volume.ID, fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volume.ID, utils.WrapError(err))
 	}
 
 	return volume.ID, nil
@@ -480,10 +1248,15 @@ func (b *BlockStore) GetVolumeInfo(volumeID, volumeAZ string) (string, *int64, e
 	})
 	logWithFields.Info("BlockStore.GetVolumeInfo called")
 
-	volume, err := volumes.Get(context.TODO(), b.client, volumeID).Extract()
+	t, _, err := b.forVolume(volumeID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	volume, err := volumes.Get(context.TODO(), t.client, volumeID).Extract()
 	if err != nil {
-		logWithFields.Error("failed to get volume from cinder")
-		return "", nil, fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get volume from cinder")
+		return "", nil, fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, utils.WrapError(err))
 	}
 
 	return volume.VolumeType, nil, nil
@@ -497,11 +1270,16 @@ func (b *BlockStore) IsVolumeReady(volumeID, volumeAZ string) (ready bool, err e
 	})
 	logWithFields.Info("BlockStore.IsVolumeReady called")
 
+	t, _, err := b.forVolume(volumeID)
+	if err != nil {
+		return false, err
+	}
+
 	// Get volume object from Cinder
-	volume, err := volumes.Get(context.TODO(), b.client, volumeID).Extract()
+	volume, err := volumes.Get(context.TODO(), t.client, volumeID).Extract()
 	if err != nil {
-		logWithFields.Error("failed to get volume from cinder")
-		return false, fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get volume from cinder")
+		return false, fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, utils.WrapError(err))
 	}
 
 	if utils.SliceContains(volumeStatuses, volume.Status) {
@@ -515,15 +1293,50 @@ func (b *BlockStore) IsVolumeReady(volumeID, volumeAZ string) (ready bool, err e
 // CreateSnapshot creates a snapshot of the specified volume, and applies any provided
 // set of tags to the snapshot.
 func (b *BlockStore) CreateSnapshot(volumeID, volumeAZ string, tags map[string]string) (string, error) {
+	t, trustID, err := b.forVolume(volumeID)
+	if err != nil {
+		return "", err
+	}
+
+	method, err := t.volumeMethod(volumeID)
+	if err != nil {
+		t.log.WithField("volumeID", volumeID).WithFields(utils.ErrorFields(err)).Error("failed to get snapshot method for volume")
+		return "", err
+	}
+
+	m, err := t.withMethod(method)
+	if err != nil {
+		return "", err
+	}
+
+	snapshotID, err := m.createSnapshotByMethod(volumeID, volumeAZ, tags)
+	if snapshotID != "" {
+		// record the method, so the snapshot survives the method config changes
+		snapshotID = utils.JoinTrustID(utils.JoinMethod(method, snapshotID), trustID)
+	}
+
+	b.triggerTiering()
+
+	return snapshotID, err
+}
+
+func (b *BlockStore) createSnapshotByMethod(volumeID, volumeAZ string, tags map[string]string) (string, error) {
 	switch b.config["method"] {
 	case "clone":
 		return b.createClone(volumeID, volumeAZ, tags)
-	case "backup":
+	case "backup", "snapshot-backup":
 		return b.createBackup(volumeID, volumeAZ, tags)
 	case "image":
 		return b.createImage(volumeID, volumeAZ, tags)
 	}
 
+	if b.groupSnapshots {
+		snapshotID, ok, err := b.createGroupSnapshotMember(volumeID, volumeAZ, tags)
+		if ok {
+			return snapshotID, err
+		}
+	}
+
 	return b.createSnapshot(volumeID, volumeAZ, tags)
 }
 
@@ -542,8 +1355,8 @@ func (b *BlockStore) createSnapshot(volumeID, volumeAZ string, tags map[string]s
 
 	originVolume, err := volumes.Get(context.TODO(), b.client, volumeID).Extract()
 	if err != nil {
-		logWithFields.Error("failed to get volume from cinder")
-		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get volume from cinder")
+		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, utils.WrapError(err))
 	}
 
 	opts := snapshots.CreateOpts{
@@ -553,16 +1366,20 @@ func (b *BlockStore) createSnapshot(volumeID, volumeAZ string, tags map[string]s
 		VolumeID:    volumeID,
 		Force:       true,
 	}
+	// only snapshots of locations with tiering are converted into backups
+	if b.tierAfter > 0 {
+		opts.Metadata = utils.Merge(opts.Metadata, map[string]string{tierAfterKey: strconv.Itoa(b.tierAfter)})
+	}
 	snapshot, err := snapshots.Create(context.TODO(), b.client, opts).Extract()
 	if err != nil {
-		logWithFields.Error("failed to create snapshot from volume")
-		return "", fmt.Errorf("failed to create snapshot %v from volume %v: %w", snapshotName, volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create snapshot from volume")
+		return "", fmt.Errorf("failed to create snapshot %v from volume %v: %w", snapshotName, volumeID, utils.WrapError(err))
 	}
 
 	_, err = b.waitForSnapshotStatus(snapshot.ID, snapshotStatuses, b.snapshotTimeout)
 	if err != nil {
-		logWithFields.Error("snapshot didn't get into 'available' state within the time limit")
-		return snapshot.ID, fmt.Errorf("snapshot %v didn't get into 'available' state within the time limit: %w", snapshot.ID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("snapshot didn't get into 'available' state within the time limit")
+		return snapshot.ID, fmt.Errorf("snapshot %v didn't get into 'available' state within the time limit: %w", snapshot.ID, utils.WrapError(err))
 	}
 	logWithFields.Info("Snapshot is in 'available' state")
 
@@ -611,21 +1428,16 @@ func (b *BlockStore) createBackup(volumeID, volumeAZ string, tags map[string]str
 
 	originVolume, err := volumes.Get(context.TODO(), b.client, volumeID).Extract()
 	if err != nil {
-		logWithFields.Error("failed to get volume from cinder")
-		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
-	}
-
-	existingBackups, err := b.getVolumeBackups(logWithFields, volumeID)
-	if err != nil {
-		logWithFields.Error("failed to retrieve existing volume backups.")
-		return "", fmt.Errorf("failed to retrieve existing backups %v from cinder: %w", volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get volume from cinder")
+		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, utils.WrapError(err))
 	}
 
-	var existingBackup *backups.Backup
-	for _, b := range existingBackups {
-		if b.VolumeID == volumeID && utils.SliceContains(backupStatuses, b.Status) {
-			existingBackup = &b
-			break
+	var parentBackup *backups.Backup
+	if b.backupIncremental {
+		parentBackup, err = b.selectParentBackup(logWithFields, volumeID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to retrieve existing volume backups.")
+			return "", fmt.Errorf("failed to retrieve existing backups %v from cinder: %w", volumeID, utils.WrapError(err))
 		}
 	}
 
@@ -644,31 +1456,91 @@ func (b *BlockStore) createBackup(volumeID, volumeAZ string, tags map[string]str
 		opts.Container = b.containerName
 	}
 
-	// Disable incremental backup for volume where no backup exists yet.
-	if b.backupIncremental && existingBackup == nil {
-		logWithFields.Infof("No backup exists yet for volume %s, will first run a full backup.", volumeID)
+	// back up a temporary snapshot to keep the point-in-time moment short
+	if b.config["method"] == "snapshot-backup" {
+		snapshotID, err := b.createTemporarySnapshot(logWithFields, volumeID, backupName)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create temporary snapshot from volume")
+			return "", err
+		}
+		defer b.deleteTemporarySnapshot(logWithFields, snapshotID)
+		opts.SnapshotID = snapshotID
+	}
+
+	// Disable incremental backup for volume without a suitable parent backup.
+	if b.backupIncremental && parentBackup == nil {
 		opts.Incremental = false
 	}
+	// record the parent backup to delete it after its dependent backups
+	if opts.Incremental {
+		opts.Metadata[backupParentKey] = parentBackup.ID
+	}
 
 	backup, err := backups.Create(context.TODO(), b.client, opts).Extract()
 	if err != nil {
-		logWithFields.Error("failed to create backup from volume")
-		return "", fmt.Errorf("failed to create backup %v from volume %v: %w", backupName, volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create backup from volume")
+		return "", fmt.Errorf("failed to create backup %v from volume %v: %w", backupName, volumeID, utils.WrapError(err))
 	}
 
 	_, err = b.waitForBackupStatus(backup.ID, backupStatuses, b.backupTimeout)
 	if err != nil {
-		logWithFields.Error("backup didn't get into 'available' state within the time limit")
-		return backup.ID, fmt.Errorf("backup %v didn't get into 'available' state within the time limit: %w", backup.ID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("backup didn't get into 'available' state within the time limit")
+		return backup.ID, fmt.Errorf("backup %v didn't get into 'available' state within the time limit: %w", backup.ID, utils.WrapError(err))
 	}
 	logWithFields.Info("Volume backup is in 'available' state")
 
+	if b.recordContainer != "" {
+		err = b.exportBackupRecord(logWithFields, backup.ID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to export backup record")
+			return backup.ID, err
+		}
+	}
+
 	logWithFields.WithFields(logrus.Fields{
 		"backupID": backup.ID,
 	}).Info("Volume backup finished successfuly")
 	return backup.ID, nil
 }
 
+// createTemporarySnapshot creates a snapshot of the volume to be backed up
+func (b *BlockStore) createTemporarySnapshot(logWithFields *logrus.Entry, volumeID, snapshotName string) (string, error) {
+	opts := snapshots.CreateOpts{
+		Name:        snapshotName,
+		Description: "Velero temp snapshot",
+		VolumeID:    volumeID,
+		Force:       true,
+	}
+	snapshot, err := snapshots.Create(context.TODO(), b.client, opts).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary snapshot %v from volume %v: %w", snapshotName, volumeID, utils.WrapError(err))
+	}
+
+	_, err = b.waitForSnapshotStatus(snapshot.ID, snapshotStatuses, b.snapshotTimeout)
+	if err != nil {
+		b.deleteTemporarySnapshot(logWithFields, snapshot.ID)
+		return "", fmt.Errorf("temporary snapshot %v didn't get into 'available' state within the time limit: %w", snapshot.ID, utils.WrapError(err))
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"snapshotID": snapshot.ID,
+	}).Info("Temporary snapshot is in 'available' state")
+	return snapshot.ID, nil
+}
+
+// deleteTemporarySnapshot deletes the temporary snapshot, errors are only logged
+func (b *BlockStore) deleteTemporarySnapshot(logWithFields *logrus.Entry, snapshotID string) {
+	var err error
+	if b.ensureDeleted {
+		err = b.ensureSnapshotDeleted(logWithFields, snapshotID, b.snapshotTimeout)
+	} else {
+		err = snapshots.Delete(context.TODO(), b.client, snapshotID).ExtractErr()
+	}
+	if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete a temporary %s snapshot", snapshotID)
+	}
+}
+
 func (b *BlockStore) createImage(volumeID, volumeAZ string, tags map[string]string) (string, error) {
 	imageName := fmt.Sprintf("%s.image.%s", volumeID, strconv.FormatUint(utils.Rand.Uint64(), 10))
 	logWithFields := b.log.WithFields(logrus.Fields{
@@ -683,8 +1555,8 @@ func (b *BlockStore) createImage(volumeID, volumeAZ string, tags map[string]stri
 
 	originVolume, err := volumes.Get(context.TODO(), b.client, volumeID).Extract()
 	if err != nil {
-		logWithFields.Error("failed to get volume from cinder")
-		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get volume from cinder")
+		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, utils.WrapError(err))
 	}
 
 	opts := &volumes.UploadImageOpts{
@@ -694,26 +1566,67 @@ func (b *BlockStore) createImage(volumeID, volumeAZ string, tags map[string]stri
 		DiskFormat:      originVolume.VolumeImageMetadata["disk_format"],
 		Visibility:      string(images.ImageVisibilityPrivate),
 		Force:           true,
-		// TODO: add Metadata support
+	}
+	if b.imageDiskFormat != "" {
+		opts.DiskFormat = b.imageDiskFormat
+	}
+	if b.imageCompression {
+		// the compression must be allowed by the Cinder
+		// "allow_compression_on_image_upload" option
+		opts.ContainerFormat = "compressed"
 	}
 	image, err := volumes.UploadImage(context.TODO(), b.client, volumeID, opts).Extract()
+	if err != nil && gophercloud.ResponseCodeIs(err, http.StatusBadRequest) && (b.imageDiskFormat != "" || b.imageCompression) {
+		logWithFields.WithFields(utils.ErrorFields(err)).Warningf("Cinder doesn't support %q disk format with %q container format, falling back to the volume image format", opts.DiskFormat, opts.ContainerFormat)
+		opts.ContainerFormat = originVolume.VolumeImageMetadata["container_format"]
+		opts.DiskFormat = originVolume.VolumeImageMetadata["disk_format"]
+		image, err = volumes.UploadImage(context.TODO(), b.client, volumeID, opts).Extract()
+	}
 	if err != nil {
-		logWithFields.Error("failed to create image from volume")
-		return "", fmt.Errorf("failed to create image %v from volume %v: %w", imageName, volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create image from volume")
+		return "", fmt.Errorf("failed to create image %v from volume %v: %w", imageName, volumeID, utils.WrapError(err))
+	}
+
+	logWithFields = logWithFields.WithFields(logrus.Fields{
+		"diskFormat":      image.DiskFormat,
+		"containerFormat": image.ContainerFormat,
+	})
+	if b.imageDiskFormat != "" && image.DiskFormat != b.imageDiskFormat {
+		logWithFields.Warningf("Volume image was created with %q disk format instead of %q", image.DiskFormat, b.imageDiskFormat)
 	}
 
 	_, err = b.waitForImageStatus(image.ImageID, imageStatuses, b.imageTimeout)
 	if err != nil {
-		logWithFields.Error("image didn't get into 'active' state within the time limit")
-		return image.ImageID, fmt.Errorf("image %v didn't get into 'active' state within the time limit: %w", image.ImageID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("image didn't get into 'active' state within the time limit")
+		return image.ImageID, fmt.Errorf("image %v didn't get into 'active' state within the time limit: %w", image.ImageID, utils.WrapError(err))
 	}
 	logWithFields.Info("Volume image is in 'active' state")
 
-	updateProperties := expandVolumeProperties(logWithFields, originVolume)
+	updateProperties := expandVolumeProperties(logWithFields, originVolume, tags)
+	if b.imageProtected {
+		// prevent other tooling from deleting the image
+		updateProperties = append(updateProperties, images.ReplaceImageProtected{NewProtected: true})
+	}
 	_, err = images.Update(context.TODO(), b.imgClient, image.ImageID, updateProperties).Extract()
 	if err != nil {
-		logWithFields.Error("failed to update image properties")
-		return image.ImageID, fmt.Errorf("failed to update image properties: %w", err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to update image properties")
+		return image.ImageID, fmt.Errorf("failed to update image properties: %w", utils.WrapError(err))
+	}
+
+	if len(b.imageStores) > 0 {
+		err = b.copyImageToStores(logWithFields, image.ImageID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to copy image into additional stores")
+			return image.ImageID, err
+		}
+	}
+
+	if b.exportContainer != "" {
+		err = b.exportImage(logWithFields, image.ImageID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to export image")
+			return image.ImageID, err
+		}
 	}
 
 	logWithFields.WithFields(logrus.Fields{
@@ -724,10 +1637,21 @@ func (b *BlockStore) createImage(volumeID, volumeAZ string, tags map[string]stri
 
 // DeleteSnapshot deletes the specified volume snapshot.
 func (b *BlockStore) DeleteSnapshot(snapshotID string) error {
+	t, snapshotID, _, err := b.forSnapshot(snapshotID)
+	if err != nil {
+		return err
+	}
+
+	b.triggerTiering()
+
+	return t.deleteSnapshotByMethod(snapshotID)
+}
+
+func (b *BlockStore) deleteSnapshotByMethod(snapshotID string) error {
 	switch b.config["method"] {
 	case "clone":
 		return b.deleteClone(snapshotID)
-	case "backup":
+	case "backup", "snapshot-backup":
 		return b.deleteBackup(snapshotID)
 	case "image":
 		return b.deleteImage(snapshotID)
@@ -743,6 +1667,24 @@ func (b *BlockStore) deleteSnapshot(snapshotID string) error {
 	})
 	logWithFields.Info("BlockStore.DeleteSnapshot called")
 
+	// snapshots of a group snapshot cannot be deleted separately, they are
+	// recognized by the member metadata even when group snapshots are
+	// disabled in the meantime
+	if g := b.withGroupMicroversion(); g != nil {
+		snapshot, err := snapshots.Get(context.TODO(), g.client, snapshotID).Extract()
+		if err != nil {
+			if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+				logWithFields.Info("snapshot is already deleted")
+				return nil
+			}
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get snapshot from cinder")
+			return fmt.Errorf("failed to get snapshot %v from cinder: %w", snapshotID, utils.WrapError(err))
+		}
+		if snapshot.GroupSnapshotID != "" && snapshot.Metadata[groupSnapshotMemberKey] != "" {
+			return g.deleteGroupSnapshotMember(logWithFields, snapshot)
+		}
+	}
+
 	// Delete snapshot from Cinder
 	if b.ensureDeleted {
 		logWithFields.Infof("waiting for a %s snapshot to be deleted", snapshotID)
@@ -755,8 +1697,8 @@ func (b *BlockStore) deleteSnapshot(snapshotID string) error {
 			logWithFields.Info("snapshot is already deleted")
 			return nil
 		}
-		logWithFields.Error("failed to delete snapshot")
-		return fmt.Errorf("failed to delete snapshot %v: %w", snapshotID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete snapshot")
+		return fmt.Errorf("failed to delete snapshot %v: %w", snapshotID, utils.WrapError(err))
 	}
 
 	return nil
@@ -769,7 +1711,7 @@ func (b *BlockStore) deleteSnapshots(logWithFields *logrus.Entry, volumeID strin
 	}
 	pages, err := snapshots.List(b.client, listOpts).AllPages(context.TODO())
 	if err != nil {
-		return fmt.Errorf("failed to list %s volume snapshots: %w", volumeID, err)
+		return fmt.Errorf("failed to list %s volume snapshots: %w", volumeID, utils.WrapError(err))
 	}
 	allSnapshots, err := snapshots.ExtractSnapshots(pages)
 	if err != nil {
@@ -782,8 +1724,8 @@ func (b *BlockStore) deleteSnapshots(logWithFields *logrus.Entry, volumeID strin
 		logWithFields.Infof("deleting the %s snapshot", snapshotID)
 		err := b.ensureSnapshotDeleted(logWithFields, snapshotID, b.snapshotTimeout)
 		if err != nil {
-			logWithFields.Errorf("failed to delete %s volume snapshot: %v", snapshotID, err)
-			errs <- fmt.Errorf("failed to delete %s volume snapshot: %w", snapshotID, err)
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete %s volume snapshot: %v", snapshotID, err)
+			errs <- fmt.Errorf("failed to delete %s volume snapshot: %w", snapshotID, utils.WrapError(err))
 		}
 		wg.Done()
 	}
@@ -814,7 +1756,7 @@ func (b *BlockStore) deleteClone(cloneID string) error {
 	if cloneID != "" && b.cascadeDelete {
 		err := b.deleteSnapshots(logWithFields, cloneID)
 		if err != nil {
-			return fmt.Errorf("failed to delete %s volume snapshots: %w", cloneID, err)
+			return fmt.Errorf("failed to delete %s volume snapshots: %w", cloneID, utils.WrapError(err))
 		}
 	}
 
@@ -830,8 +1772,8 @@ func (b *BlockStore) deleteClone(cloneID string) error {
 			logWithFields.Info("volume clone is already deleted")
 			return nil
 		}
-		logWithFields.Error("failed to delete volume clone")
-		return fmt.Errorf("failed to delete volume clone %v: %w", cloneID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete volume clone")
+		return fmt.Errorf("failed to delete volume clone %v: %w", cloneID, utils.WrapError(err))
 	}
 
 	return nil
@@ -844,20 +1786,61 @@ func (b *BlockStore) deleteBackup(backupID string) error {
 	})
 	logWithFields.Info("BlockStore.DeleteSnapshot called")
 
+	backup, err := backups.Get(context.TODO(), b.client, backupID).Extract()
+	if err != nil {
+		if !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get volume backup")
+			return fmt.Errorf("failed to get volume backup %v: %w", backupID, utils.WrapError(err))
+		}
+		backup = nil
+	}
+
+	// Cinder refuses to delete backups with dependent incremental backups
+	if backup != nil && backup.HasDependentBackups {
+		err = b.markBackupPendingDeletion(logWithFields, backup)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to mark volume backup pending deletion")
+			return err
+		}
+		return nil
+	}
+
 	// Delete volume backup from Cinder
 	if b.ensureDeleted {
 		logWithFields.Infof("waiting for a %s volume backup deleted", backupID)
-		return b.ensureBackupDeleted(logWithFields, backupID, b.backupTimeout)
+		err := b.ensureBackupDeleted(logWithFields, backupID, b.backupTimeout)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := backups.Delete(context.TODO(), b.client, backupID).ExtractErr()
+		if err != nil {
+			if !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+				logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete volume backup")
+				return fmt.Errorf("failed to delete volume backup %v: %w", backupID, utils.WrapError(err))
+			}
+			logWithFields.Info("volume backup is already deleted")
+		}
 	}
 
-	err := backups.Delete(context.TODO(), b.client, backupID).ExtractErr()
-	if err != nil {
-		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
-			logWithFields.Info("volume backup is already deleted")
-			return nil
+	// Delete exported backup record from Swift
+	if b.recordContainer != "" {
+		err := b.deleteBackupRecord(backupID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete backup record")
+			return err
 		}
-		logWithFields.Error("failed to delete volume backup")
-		return fmt.Errorf("failed to delete volume backup %v: %w", backupID, err)
+	}
+
+	// Delete the parent backups, which wait for their last dependent backup
+	deletedID := ""
+	if backup != nil {
+		deletedID = backupID
+	}
+	err = b.deletePendingBackups(logWithFields, deletedID)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete parent volume backups")
+		return err
 	}
 
 	return nil
@@ -870,15 +1853,53 @@ func (b *BlockStore) deleteImage(imageID string) error {
 	})
 	logWithFields.Info("BlockStore.DeleteSnapshot called")
 
+	if b.exportContainer != "" {
+		err := b.deleteExport(logWithFields, imageID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete exported image")
+			return err
+		}
+	}
+
+	image, err := images.Get(context.TODO(), b.imgClient, imageID).Extract()
+	if err != nil {
+		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			logWithFields.Info("volume image is already deleted")
+			return nil
+		}
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get volume image")
+		return fmt.Errorf("failed to get volume image %v: %w", imageID, utils.WrapError(err))
+	}
+
+	// Glance refuses to delete protected images
+	if image.Protected {
+		logWithFields.Info("unprotecting volume image")
+		_, err = images.Update(context.TODO(), b.imgClient, imageID, images.UpdateOpts{images.ReplaceImageProtected{NewProtected: false}}).Extract()
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to unprotect volume image")
+			return fmt.Errorf("failed to unprotect volume image %v: %w", imageID, utils.WrapError(err))
+		}
+	}
+
 	// Delete volume image from Glance
-	err := images.Delete(context.TODO(), b.imgClient, imageID).ExtractErr()
+	if b.ensureDeleted {
+		logWithFields.Infof("waiting for a %s volume image deleted", imageID)
+		err := b.ensureImageDeleted(logWithFields, imageID, b.imageTimeout)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete volume image")
+			return fmt.Errorf("failed to delete volume image %v: %w", imageID, utils.WrapError(err))
+		}
+		return nil
+	}
+
+	err = images.Delete(context.TODO(), b.imgClient, imageID).ExtractErr()
 	if err != nil {
 		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
 			logWithFields.Info("volume image is already deleted")
 			return nil
 		}
-		logWithFields.Error("failed to delete volume image")
-		return fmt.Errorf("failed to delete volume image %v: %w", imageID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete volume image")
+		return fmt.Errorf("failed to delete volume image %v: %w", imageID, utils.WrapError(err))
 	}
 
 	return nil
@@ -896,21 +1917,47 @@ func (b *BlockStore) GetVolumeID(unstructuredPV runtime.Unstructured) (string, e
 		return "", fmt.Errorf("failed to convert from unstructured PV: %w", err)
 	}
 
-	if pv.Spec.Cinder != nil {
-		return pv.Spec.Cinder.VolumeID, nil
+	volumeID := getPVVolumeID(pv)
+	if volumeID == "" {
+		if pv.Spec.CSI != nil {
+			b.log.Infof("Unable to handle CSI driver: %s", pv.Spec.CSI.Driver)
+		}
+		return "", nil
 	}
 
-	if pv.Spec.CSI == nil {
-		return "", nil
+	// remember the trust ID to access the volume in the trustor project
+	trustID, err := utils.GetTrustID(pv, b.trusts, b.config["trustID"])
+	if err != nil {
+		return "", fmt.Errorf("failed to get a trust ID for %v volume: %w", volumeID, err)
+	}
+	if trustID != "" {
+		b.trustCache.SetVolumeTrustID(volumeID, trustID)
 	}
 
-	if utils.SliceContains(supportedDrivers, pv.Spec.CSI.Driver) {
-		return pv.Spec.CSI.VolumeHandle, nil
+	// remember the PVC group to snapshot the volume together with the group
+	if b.groupSnapshots {
+		g, ok, err := b.getVolumeGroup(pv)
+		if err != nil {
+			return "", fmt.Errorf("failed to get a group of %v volume: %w", volumeID, err)
+		}
+		if ok {
+			b.groupCache.setVolumeGroup(volumeID, g)
+		}
 	}
 
-	b.log.Infof("Unable to handle CSI driver: %s", pv.Spec.CSI.Driver)
+	return volumeID, nil
+}
 
-	return "", nil
+// getPVVolumeID returns the Cinder volume ID of the persistent volume or an
+// empty string, when the volume is not managed by Cinder
+func getPVVolumeID(pv *v1.PersistentVolume) string {
+	if pv.Spec.Cinder != nil {
+		return pv.Spec.Cinder.VolumeID
+	}
+	if pv.Spec.CSI != nil && utils.SliceContains(supportedDrivers, pv.Spec.CSI.Driver) {
+		return pv.Spec.CSI.VolumeHandle
+	}
+	return ""
 }
 
 // SetVolumeID sets the specific identifier for the PersistentVolume.
@@ -934,6 +1981,20 @@ func (b *BlockStore) SetVolumeID(unstructuredPV runtime.Unstructured, volumeID s
 		return nil, fmt.Errorf("persistent volume is missing 'spec.cinder.volumeID' or PV driver ('spec.csi.driver') doesn't match supported drivers (%v)", supportedDrivers)
 	}
 
+	if b.volumeTransfer {
+		err := b.transferVolume(logWithFields, pv, volumeID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to transfer restored volume into the target project")
+			return nil, err
+		}
+	}
+
+	// reflect the availability zone of the restored volume in the PV topology
+	if az := b.azCache.VolumeAZ(volumeID); az != "" {
+		logWithFields.Infof("Setting %q availability zone in the PV topology", az)
+		utils.SetPVZone(pv, az, csiTopologyKey)
+	}
+
 	res, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pv)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert to unstructured PV: %w", err)
@@ -964,7 +2025,7 @@ func (b *BlockStore) setCinderMicroversion(version string) error {
 		return fmt.Errorf("failed to compare supported Cinder microversions: %v", err)
 	}
 	if !ok {
-		return fmt.Errorf("the %v Cinder microversion doesn't support %ss", mv, b.config["method"])
+		return fmt.Errorf("the %v Cinder microversion doesn't support the required %v microversion", mv, version)
 	}
 
 	b.client.Microversion = version
@@ -972,6 +2033,26 @@ func (b *BlockStore) setCinderMicroversion(version string) error {
 	return nil
 }
 
+// supportsMicroversion returns true, when Cinder supports the microversion
+func (b *BlockStore) supportsMicroversion(version string) (bool, error) {
+	if b.client.Microversion != "" {
+		ok, err := utils.CompareMicroversions("lte", version, b.client.Microversion)
+		if err == nil && ok {
+			return true, nil
+		}
+	}
+
+	mv, err := b.getCinderMicroversion()
+	if err != nil {
+		return false, fmt.Errorf("failed to obtain supported Cinder microversions: %v", err)
+	}
+	ok, err := utils.CompareMicroversions("lte", version, mv)
+	if err != nil {
+		return false, fmt.Errorf("failed to compare supported Cinder microversions: %v", err)
+	}
+	return ok, nil
+}
+
 func (b *BlockStore) waitForVolumeStatus(id string, statuses []string, secs int) (current *volumes.Volume, err error) {
 	return current, utils.WaitForStatus(statuses, secs, func() (string, error) {
 		current, err = volumes.Get(context.TODO(), b.client, id).Extract()
@@ -1102,7 +2183,33 @@ func (b *BlockStore) ensureBackupDeleted(logWithFields *logrus.Entry, id string,
 	return utils.EnsureDeleted(deleteFunc, checkFunc, resetFunc, secs, b.ensureDeletedDelay)
 }
 
-func expandVolumeProperties(log logrus.FieldLogger, volume *volumes.Volume) images.UpdateOpts {
+func (b *BlockStore) ensureImageDeleted(logWithFields *logrus.Entry, id string, secs int) error {
+	deleteFunc := func() error {
+		err := images.Delete(context.TODO(), b.imgClient, id).ExtractErr()
+		if err != nil {
+			logWithFields.Infof("failed to delete a %s image: %v", id, err)
+		}
+		return err
+	}
+	checkFunc := func() error {
+		// images are kept in "pending_delete" status, when Glance delayed
+		// delete is enabled
+		_, err := b.waitForImageStatus(id, []string{"deleted", string(images.ImageStatusPendingDelete)}, secs)
+		if err != nil {
+			logWithFields.Infof("failed to wait for a %s image status: %v", id, err)
+		}
+		return err
+	}
+	resetFunc := func() error {
+		// Glance doesn't support image status reset, try to delete it again
+		logWithFields.Infof("trying to delete a %s image again", id)
+		return nil
+	}
+
+	return utils.EnsureDeleted(deleteFunc, checkFunc, resetFunc, secs, b.ensureDeletedDelay)
+}
+
+func expandVolumeProperties(log logrus.FieldLogger, volume *volumes.Volume, tags map[string]string) images.UpdateOpts {
 	// set min_disk and min_ram from a source volume
 	imgAttrUpdateOpts := images.UpdateOpts{
 		images.ReplaceImageMinDisk{NewMinDisk: volume.Size},
@@ -1120,18 +2227,50 @@ func expandVolumeProperties(log logrus.FieldLogger, volume *volumes.Volume) imag
 		}
 		imgAttrUpdateOpts = append(imgAttrUpdateOpts, images.UpdateImageProperty{
 			Op:    images.AddOp,
-			Name:  key,
+			Name:  imagePropertyPath(key),
+			Value: value,
+		})
+	}
+	// store the volume metadata and Velero tags as namespaced properties
+	for key, value := range utils.Merge(volume.Metadata, tags) {
+		imgAttrUpdateOpts = append(imgAttrUpdateOpts, images.UpdateImageProperty{
+			Op:    images.AddOp,
+			Name:  imagePropertyPath(imageMetadataPrefix + key),
 			Value: value,
 		})
 	}
 	return imgAttrUpdateOpts
 }
 
+// imagePropertyPath escapes the image property name for the JSON patch path,
+// gophercloud uses the name as is and Glance would treat "/" as a nested path
+func imagePropertyPath(name string) string {
+	return jsonPointerEscaper.Replace(name)
+}
+
+// imageVolumeMetadata returns the volume metadata stored in the image
+// properties
+func imageVolumeMetadata(image *images.Image) map[string]string {
+	metadata := make(map[string]string)
+	for key, value := range image.Properties {
+		if k, ok := strings.CutPrefix(key, imageMetadataPrefix); ok {
+			if v, ok := value.(string); ok {
+				metadata[k] = v
+			}
+		}
+	}
+	return metadata
+}
+
 func (b *BlockStore) getVolumeBackups(logWithFields *logrus.Entry, volumeID string) ([]backups.Backup, error) {
-	// use detail and a non-volumeid search to allow usage of later microversions
-	pages, err := backups.ListDetail(b.client, nil).AllPages(context.TODO())
+	// filter backups by the volume and list the most recent ones first
+	opts := backupListOpts{
+		VolumeID: volumeID,
+		Sort:     "created_at:desc",
+	}
+	pages, err := backups.ListDetail(b.client, opts).AllPages(context.TODO())
 	if err != nil {
-		return nil, fmt.Errorf("failed to list backups: %w", err)
+		return nil, fmt.Errorf("failed to list backups: %w", utils.WrapError(err))
 	}
 
 	allBackups, err := backups.ExtractBackups(pages)
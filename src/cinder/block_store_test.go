@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	"github.com/Lirt/velero-plugin-for-openstack/src/testhelper"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
 	th "github.com/gophercloud/gophercloud/v2/testhelper"
 	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
 	"github.com/sirupsen/logrus"
@@ -241,6 +243,14 @@ func handleListBackupsDetail(t *testing.T, fakeServer th.FakeServer) {
 			t.Errorf("Failed to parse request form %v", err)
 		}
 		marker := r.Form.Get("marker")
+		// no backups are pending deletion
+		if r.Form.Get("metadata") != "" {
+			fmt.Fprintf(w, `{"backups": []}`)
+			return
+		}
+		if marker == "" && r.Form.Get("volume_id") == "" {
+			t.Errorf("Expected backups to be filtered by a volume ID")
+		}
 		switch marker {
 		case "":
 			fmt.Fprintf(w, listDetailResponse, fakeServer.Server.URL)
@@ -399,3 +409,387 @@ func TestCreateBackup(t *testing.T) {
 		}
 	}
 }
+
+// TestBlockStorageInitEndpointOverride verifies that the catalog endpoint
+// is replaced by the endpoint override with an expanded project ID.
+func TestBlockStorageInitEndpointOverride(t *testing.T) {
+	log := logrus.New()
+	config := map[string]string{
+		"cloud":                  "myCloud",
+		"cinderEndpointOverride": "http://cinder.internal:8776/v3/%(project_id)s",
+	}
+	bs := NewBlockStore(log)
+
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+	bs.provider = fakeClient.ServiceClient(fakeServer).ProviderClient
+	bs.provider.IdentityEndpoint = fakeServer.Endpoint() + "v3/auth/tokens"
+
+	tempDir, origDir := testhelper.TempCloudsYAML(t, bs.provider.IdentityEndpoint)
+	defer testhelper.TempCloudsYAMLCleanup(t, tempDir, origDir)
+
+	testhelper.MuxKeystoneVersionDiscovery(fakeServer, fakeServer.Endpoint()+"v3/")
+	fakeServer.Mux.HandleFunc("/v3/auth/tokens",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Subject-Token", ID)
+
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, tokenResp)
+		},
+	)
+
+	if err := bs.Init(config); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "http://cinder.internal:8776/v3/04982538-f42b-11ee-a412-9cb6d0fbac9d/"
+	if bs.client.Endpoint != expected {
+		t.Errorf("expected %q endpoint, got %q", expected, bs.client.Endpoint)
+	}
+}
+
+func TestOverrideImageEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		expected string
+	}{
+		{"http://glance.internal:9292", "http://glance.internal:9292/v2/"},
+		{"http://glance.internal:9292/v2", "http://glance.internal:9292/v2/"},
+		{"http://glance.internal:9292/v2.1/", "http://glance.internal:9292/v2/"},
+		{"http://proxy.internal/glance/v2", "http://proxy.internal/glance/v2/"},
+		{"http://proxy.internal/glancev2", "http://proxy.internal/glancev2/v2/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}}
+			assert.NoError(t, overrideImageEndpoint(client, tt.endpoint))
+			assert.Equal(t, tt.expected, client.ResourceBase)
+		})
+	}
+}
+
+func TestCreateVolumeFromSnapshotEnforceAZ(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	deleted := make(map[string]bool)
+	var createdAZs []string
+	failTarget := false
+
+	fakeServer.Mux.HandleFunc("/snapshots/snap1", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"snapshot": {"id": "snap1", "volume_id": "src", "status": "available"}}`)
+	})
+	fakeServer.Mux.HandleFunc("/volumes", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		var req struct {
+			Volume struct {
+				AvailabilityZone string `json:"availability_zone"`
+				SnapshotID       string `json:"snapshot_id"`
+				BackupID         string `json:"backup_id"`
+			} `json:"volume"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		createdAZs = append(createdAZs, req.Volume.AvailabilityZone)
+		id := "intermediate"
+		if req.Volume.BackupID != "" {
+			assert.Equal(t, "bk1", req.Volume.BackupID)
+			id = "target"
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, `{"volume": {"id": "%s", "status": "creating", "availability_zone": "%s"}}`, id, req.Volume.AvailabilityZone)
+	})
+	for id, az := range map[string]string{"src": "az1", "intermediate": "az1", "target": "az2"} {
+		fakeServer.Mux.HandleFunc("/volumes/"+id, func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "GET":
+				if deleted[id] {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				status := "available"
+				if id == "target" && failTarget {
+					status = "error"
+				}
+				w.Header().Add("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"volume": {"id": "%s", "name": "vol", "status": "%s", "volume_type": "ssd", "availability_zone": "%s"}}`, id, status, az)
+			case "DELETE":
+				deleted[id] = true
+				w.WriteHeader(http.StatusAccepted)
+			}
+		})
+	}
+	fakeServer.Mux.HandleFunc("/backups", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"backup": {"id": "bk1", "status": "creating"}}`)
+	})
+	fakeServer.Mux.HandleFunc("/backups/bk1", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			if deleted["bk1"] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprint(w, `{"backup": {"id": "bk1", "status": "available"}}`)
+		case "DELETE":
+			deleted["bk1"] = true
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+
+	store := BlockStore{
+		client:          fakeClient.ServiceClient(fakeServer),
+		log:             logrus.New(),
+		config:          map[string]string{"method": "snapshot"},
+		enforceAZ:       true,
+		enforceAZMethod: "backup",
+		snapshotTimeout: 3,
+		volumeTimeout:   3,
+		backupTimeout:   3,
+	}
+
+	volumeID, err := store.createVolumeFromSnapshot("snap1", "ssd", "az2")
+	assert.NoError(t, err)
+	assert.Equal(t, "target", volumeID)
+	assert.Equal(t, []string{"az1", "az2"}, createdAZs)
+	assert.True(t, deleted["intermediate"], "intermediate volume must be deleted")
+	assert.True(t, deleted["bk1"], "temporary backup must be deleted")
+	assert.False(t, deleted["target"])
+
+	// the intermediate and the failed volume are deleted, when the move fails
+	clear(deleted)
+	failTarget = true
+	volumeID, err = store.createVolumeFromSnapshot("snap1", "ssd", "az2")
+	assert.Error(t, err)
+	assert.Empty(t, volumeID)
+	assert.True(t, deleted["intermediate"], "intermediate volume must be deleted")
+	assert.True(t, deleted["target"], "failed volume must be deleted")
+	assert.True(t, deleted["bk1"], "temporary backup must be deleted")
+}
+
+func TestMethodByVolumeType(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	volumeID := "521752a6-acf6-4b2d-bc7a-119f9148cd8c"
+	backupID := "d32019d3-bc6e-4319-9c1d-6722fc136a22"
+	deleted := false
+
+	handleGetVolume(t, fakeServer, volumeID)
+	handleListBackupsDetail(t, fakeServer)
+	fakeServer.Mux.HandleFunc("/backups", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, createBackupResponse, backupID)
+	})
+	fakeServer.Mux.HandleFunc("/backups/"+backupID, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintf(w, getBackupResponse, backupID)
+		case "DELETE":
+			deleted = true
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+
+	store := NewBlockStore(logrus.New())
+	store.client = fakeClient.ServiceClient(fakeServer)
+	store.config = map[string]string{"method": "snapshot"}
+	store.methods = map[string]string{"lvmdriver-1": "backup"}
+	store.backupTimeout = 3
+
+	snapshotID, err := store.CreateSnapshot(volumeID, "nova", map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, "backup:"+backupID, snapshotID)
+
+	// the backup is deleted regardless of the default snapshot method
+	assert.NoError(t, store.DeleteSnapshot(snapshotID))
+	assert.True(t, deleted)
+}
+
+func TestDeleteSnapshotDetectMethod(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	snapshotID := "3fbbcccf-d058-4502-8844-6feeffdf4cb5"
+	deleted := false
+
+	fakeServer.Mux.HandleFunc("/backups/"+snapshotID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.WriteHeader(http.StatusNotFound)
+	})
+	fakeServer.Mux.HandleFunc("/snapshots/"+snapshotID, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"snapshot": {"id": "%s", "status": "available"}}`, snapshotID)
+		case "DELETE":
+			deleted = true
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+
+	// a snapshot ID without the method prefix created before the method change
+	store := NewBlockStore(logrus.New())
+	store.client = fakeClient.ServiceClient(fakeServer)
+	store.config = map[string]string{"method": "backup"}
+
+	assert.NoError(t, store.DeleteSnapshot(snapshotID))
+	assert.True(t, deleted)
+}
+
+func TestDeleteProtectedImage(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	imageID := "1bea47ed-f6a9-463b-b423-14b9cca9ad27"
+	protected, deleted := true, false
+
+	fakeServer.Mux.HandleFunc("/images/"+imageID, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			if deleted {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id": "%s", "status": "active", "protected": %t}`, imageID, protected)
+		case "PATCH":
+			th.TestJSONRequest(t, r, `[{"op": "replace", "path": "/protected", "value": false}]`)
+			protected = false
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id": "%s", "status": "active", "protected": false}`, imageID)
+		case "DELETE":
+			if protected {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			deleted = true
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	store := BlockStore{
+		imgClient:     fakeClient.ServiceClient(fakeServer),
+		log:           logrus.New(),
+		config:        map[string]string{"method": "image"},
+		ensureDeleted: true,
+		imageTimeout:  3,
+	}
+
+	assert.NoError(t, store.deleteImage(imageID))
+	assert.False(t, protected)
+	assert.True(t, deleted)
+}
+
+func TestCreateImageFormatFallback(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	volumeID := "b0b9a8b3-7a4f-4ab2-8b41-5b2c0c1e8d1f"
+	imageID := "1bea47ed-f6a9-463b-b423-14b9cca9ad27"
+	var uploads []string
+
+	fakeServer.Mux.HandleFunc("/volumes/"+volumeID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"volume": {"id": "%s", "status": "available", "size": 1, "volume_image_metadata": {"container_format": "bare", "disk_format": "raw"}}}`, volumeID)
+	})
+	fakeServer.Mux.HandleFunc("/volumes/"+volumeID+"/action", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		var req struct {
+			Upload volumes.UploadImageOpts `json:"os-volume_upload_image"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		uploads = append(uploads, req.Upload.ContainerFormat+"/"+req.Upload.DiskFormat)
+		if req.Upload.ContainerFormat == "compressed" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"badRequest": {"message": "Image upload with compression is disabled", "code": 400}}`)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, `{"os-volume_upload_image": {"id": "%s", "image_id": "%s", "container_format": "%s", "disk_format": "%s"}}`, volumeID, imageID, req.Upload.ContainerFormat, req.Upload.DiskFormat)
+	})
+	fakeServer.Mux.HandleFunc("/images/"+imageID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": "%s", "status": "active"}`, imageID)
+	})
+
+	store := BlockStore{
+		client:           fakeClient.ServiceClient(fakeServer),
+		imgClient:        fakeClient.ServiceClient(fakeServer),
+		log:              logrus.New(),
+		config:           map[string]string{"method": "image"},
+		imageDiskFormat:  "qcow2",
+		imageCompression: true,
+		imageTimeout:     3,
+	}
+
+	id, err := store.createImage(volumeID, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, imageID, id)
+	assert.Equal(t, []string{"compressed/qcow2", "bare/raw"}, uploads)
+}
+
+func TestCreateSnapshotBackup(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	volumeID := "521752a6-acf6-4b2d-bc7a-119f9148cd8c"
+	backupID := "d32019d3-bc6e-4319-9c1d-6722fc136a22"
+	snapshotID := "3fbbcccf-d058-4502-8844-6feeffdf4cb5"
+	snapshotDeleted := false
+
+	handleGetVolume(t, fakeServer, volumeID)
+	handleGetBackup(t, fakeServer, backupID)
+	fakeServer.Mux.HandleFunc("/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, `{"snapshot": {"id": "%s", "volume_id": "%s", "status": "creating"}}`, snapshotID, volumeID)
+	})
+	fakeServer.Mux.HandleFunc("/snapshots/"+snapshotID, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"snapshot": {"id": "%s", "volume_id": "%s", "status": "available"}}`, snapshotID, volumeID)
+		case "DELETE":
+			snapshotDeleted = true
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+	fakeServer.Mux.HandleFunc("/backups", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		var req struct {
+			Backup struct {
+				VolumeID   string `json:"volume_id"`
+				SnapshotID string `json:"snapshot_id"`
+			} `json:"backup"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.Equal(t, volumeID, req.Backup.VolumeID)
+		assert.Equal(t, snapshotID, req.Backup.SnapshotID)
+		assert.False(t, snapshotDeleted, "snapshot must exist during the backup")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, createBackupResponse, backupID)
+	})
+
+	store := NewBlockStore(logrus.New())
+	store.client = fakeClient.ServiceClient(fakeServer)
+	store.config = map[string]string{"method": "snapshot-backup"}
+	store.snapshotTimeout = 3
+	store.backupTimeout = 3
+
+	createdID, err := store.CreateSnapshot(volumeID, "nova", map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, "snapshot-backup:"+backupID, createdID)
+	assert.True(t, snapshotDeleted, "temporary snapshot must be deleted")
+}
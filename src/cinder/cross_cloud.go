@@ -0,0 +1,320 @@
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/image/v2/imagedata"
+	"github.com/gophercloud/gophercloud/v2/openstack/image/v2/images"
+	"github.com/sirupsen/logrus"
+)
+
+// transferProgressInterval is an interval of the image transfer progress
+// reports
+const transferProgressInterval = 30 * time.Second
+
+// sourceStoreCache holds block stores authenticated against the source
+// clouds
+type sourceStoreCache struct {
+	mu     sync.Mutex
+	stores map[string]*BlockStore
+}
+
+func (c *sourceStoreCache) getOrCreate(cloud, trustID string, create func() (*BlockStore, error)) (*BlockStore, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := utils.JoinTrustID(cloud, trustID)
+	if s, ok := c.stores[key]; ok {
+		return s, nil
+	}
+	s, err := create()
+	if err != nil {
+		return nil, err
+	}
+	if c.stores == nil {
+		c.stores = make(map[string]*BlockStore)
+	}
+	c.stores[key] = s
+	return s, nil
+}
+
+// forSourceCloud returns a block store of the source cloud, which contains
+// the snapshot, when it doesn't exist in the cloud of this location, and the
+// block store of this location, which the snapshot is imported with. Nil is
+// returned, when the snapshot exists here or in none of the source clouds.
+func (b *BlockStore) forSourceCloud(snapshotID string) (*BlockStore, *BlockStore, string, error) {
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"snapshotID": snapshotID,
+	})
+
+	// the snapshot exists here, including tiered snapshots and backups with
+	// an exported record
+	t, id, _, err := b.forSnapshot(snapshotID)
+	if err == nil {
+		ok, err := t.hasSnapshot(id)
+		if err != nil || ok {
+			return nil, nil, "", err
+		}
+	} else {
+		// e.g. the trust of the snapshot is unknown to this cloud
+		logWithFields.WithFields(utils.ErrorFields(err)).Warningf("failed to look up snapshot in this cloud, using the default credentials: %v", err)
+	}
+
+	bareID, trustID := utils.SplitTrustID(snapshotID)
+	method, bareID := utils.SplitMethod(bareID, supportedMethods)
+	target, err := b.withTrust(trustID)
+	if err != nil {
+		target = b
+	}
+
+	for _, cloud := range b.sourceClouds {
+		// an unreachable source cloud is treated as a miss
+		s, err := b.sourceStore(cloud, trustID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Warningf("failed to access %v source cloud: %v", cloud, err)
+			continue
+		}
+		m, err := s.findSnapshot(method, bareID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Warningf("failed to look up snapshot in %v source cloud: %v", cloud, err)
+			continue
+		}
+		if m != nil {
+			return m, target, bareID, nil
+		}
+	}
+
+	return nil, nil, "", nil
+}
+
+// hasSnapshot returns true, when the snapshot resource exists or the backup
+// can be imported from its exported record
+func (b *BlockStore) hasSnapshot(snapshotID string) (bool, error) {
+	ok, err := b.snapshotExists(snapshotID)
+	if err != nil || ok {
+		return ok, err
+	}
+	if b.recordContainer != "" && b.objClient != nil && (b.config["method"] == "backup" || b.config["method"] == "snapshot-backup") {
+		return b.backupRecordExists(snapshotID)
+	}
+	return false, nil
+}
+
+// findSnapshot returns a block store of the snapshot method, when the
+// snapshot exists in its cloud, all methods are probed, when the method is
+// empty
+func (b *BlockStore) findSnapshot(method, snapshotID string) (*BlockStore, error) {
+	if method == "" {
+		var err error
+		method, err = b.detectMethod(snapshotID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	m, err := b.withMethod(method)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := m.snapshotExists(snapshotID)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return m, nil
+}
+
+// sourceStore returns a block store authenticated against the source cloud
+// from clouds.yaml
+func (b *BlockStore) sourceStore(cloud, trustID string) (*BlockStore, error) {
+	return b.sourceCache.getOrCreate(cloud, trustID, func() (*BlockStore, error) {
+		s := *b
+		s.provider = nil
+		s.config = utils.Merge(b.config, map[string]string{
+			"cloud":                  cloud,
+			"region":                 b.sourceRegion,
+			"trustID":                trustID,
+			"cinderEndpointOverride": "",
+			"glanceEndpointOverride": "",
+		})
+		s.log = b.log.WithField("sourceCloud", cloud)
+		s.trustCache = &utils.TrustCache[*BlockStore]{}
+		s.sourceClouds = nil
+		s.exportContainer = ""
+		s.imageStores = nil
+		s.recordContainer = ""
+		err := utils.Authenticate(&s.provider, "cinder", s.config, s.log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate against %v source cloud in block storage plugin: %w", cloud, utils.WrapError(err))
+		}
+		// the source region must not be overridden by the OS_REGION_NAME
+		// env variable of this location
+		err = s.initRegionClients(b.sourceRegion)
+		if err != nil {
+			return nil, err
+		}
+		return &s, nil
+	})
+}
+
+// importFromSourceCloud copies the snapshot data from the source cloud into a
+// temporary image in the cloud of this location. The returned cleanup
+// function deletes the temporary image.
+func (b *BlockStore) importFromSourceCloud(s *BlockStore, snapshotID string) (string, func(), error) {
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"snapshotID":   snapshotID,
+		"sourceCloud":  s.config["cloud"],
+		"sourceMethod": s.config["method"],
+	})
+	logWithFields.Info("Snapshot belongs to the source cloud, importing it through an image")
+
+	src, err := s.withMethod("image")
+	if err != nil {
+		return "", nil, err
+	}
+	dst, err := b.withMethod("image")
+	if err != nil {
+		return "", nil, err
+	}
+
+	sourceImageID := snapshotID
+	if s.config["method"] != "image" {
+		// upload the volume restored in the source cloud into an image
+		volumeID, err := s.createVolume(snapshotID, "", "")
+		if volumeID != "" {
+			defer src.deleteSourceVolume(logWithFields, volumeID)
+		}
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create a temporary volume in the source cloud")
+			return "", nil, err
+		}
+		sourceImageID, err = src.uploadSourceImage(logWithFields.WithField("sourceVolumeID", volumeID), volumeID)
+		if sourceImageID != "" {
+			defer src.deleteSourceImage(logWithFields, sourceImageID)
+		}
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to upload a temporary volume into an image in the source cloud")
+			return "", nil, err
+		}
+	}
+
+	imageID, err := dst.transferImage(logWithFields.WithField("sourceImageID", sourceImageID), src.imgClient, sourceImageID)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to transfer image from the source cloud")
+		return "", nil, err
+	}
+
+	cleanup := func() {
+		if err := images.Delete(context.TODO(), dst.imgClient, imageID).ExtractErr(); err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete a temporary %s image", imageID)
+		}
+	}
+	return imageID, cleanup, nil
+}
+
+// uploadSourceImage uploads the temporary volume into a temporary image and
+// stores the volume metadata in the image properties
+func (b *BlockStore) uploadSourceImage(logWithFields *logrus.Entry, volumeID string) (string, error) {
+	volume, err := b.waitForVolumeStatus(volumeID, volumeStatuses, b.volumeTimeout)
+	if err != nil {
+		return "", fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volumeID, utils.WrapError(err))
+	}
+
+	opts := &volumes.UploadImageOpts{
+		ImageName:       fmt.Sprintf("%s.transfer.%s", volumeID, strconv.FormatUint(utils.Rand.Uint64(), 10)),
+		ContainerFormat: volume.VolumeImageMetadata["container_format"],
+		DiskFormat:      volume.VolumeImageMetadata["disk_format"],
+		Visibility:      string(images.ImageVisibilityPrivate),
+		Force:           true,
+	}
+	image, err := volumes.UploadImage(context.TODO(), b.client, volumeID, opts).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to create image from volume %v: %w", volumeID, utils.WrapError(err))
+	}
+
+	_, err = b.waitForImageStatus(image.ImageID, imageStatuses, b.imageTimeout)
+	if err != nil {
+		return image.ImageID, fmt.Errorf("image %v didn't get into 'active' state within the time limit: %w", image.ImageID, utils.WrapError(err))
+	}
+
+	_, err = images.Update(context.TODO(), b.imgClient, image.ImageID, expandVolumeProperties(logWithFields, volume, nil)).Extract()
+	if err != nil {
+		return image.ImageID, fmt.Errorf("failed to update image properties: %w", utils.WrapError(err))
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"sourceImageID": image.ImageID,
+	}).Info("Temporary volume was uploaded into an image in the source cloud")
+	return image.ImageID, nil
+}
+
+// transferImage streams the image data from the source cloud Glance into a
+// new image and returns its ID
+func (b *BlockStore) transferImage(logWithFields *logrus.Entry, srcClient *gophercloud.ServiceClient, sourceImageID string) (string, error) {
+	source, err := images.Get(context.TODO(), srcClient, sourceImageID).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to get image %v from the source cloud: %w", sourceImageID, utils.WrapError(err))
+	}
+
+	properties := make(map[string]string)
+	for key, value := range imageVolumeMetadata(source) {
+		properties[imageMetadataPrefix+key] = value
+	}
+	visibility := images.ImageVisibilityPrivate
+	opts := images.CreateOpts{
+		Name:            source.Name,
+		DiskFormat:      source.DiskFormat,
+		ContainerFormat: source.ContainerFormat,
+		MinDisk:         source.MinDiskGigabytes,
+		MinRAM:          source.MinRAMMegabytes,
+		Visibility:      &visibility,
+		Properties:      properties,
+	}
+	image, err := images.Create(context.TODO(), b.imgClient, opts).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to create image for source image %v: %w", sourceImageID, utils.WrapError(err))
+	}
+
+	data, err := imagedata.Download(context.TODO(), srcClient, sourceImageID).Extract()
+	if err == nil {
+		progress := utils.NewProgressReader(data, source.SizeBytes, transferProgressInterval, func(read, total int64) {
+			logWithFields.WithFields(logrus.Fields{
+				"transferred": read,
+				"size":        total,
+			}).Info("Transferring image from the source cloud")
+		})
+		err = imagedata.Upload(context.TODO(), b.imgClient, image.ID, progress).ExtractErr()
+		data.Close()
+	}
+	if err != nil {
+		if err := images.Delete(context.TODO(), b.imgClient, image.ID).ExtractErr(); err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete a temporary %s image", image.ID)
+		}
+		return "", fmt.Errorf("failed to transfer source image %v: %w", sourceImageID, utils.WrapError(err))
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"imageID": image.ID,
+		"size":    source.SizeBytes,
+	}).Info("Image was transferred from the source cloud")
+	return image.ID, nil
+}
+
+func (b *BlockStore) deleteSourceVolume(logWithFields *logrus.Entry, volumeID string) {
+	err := volumes.Delete(context.TODO(), b.client, volumeID, volumes.DeleteOpts{}).ExtractErr()
+	if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete a temporary %s volume in the source cloud", volumeID)
+	}
+}
+
+func (b *BlockStore) deleteSourceImage(logWithFields *logrus.Entry, imageID string) {
+	err := images.Delete(context.TODO(), b.imgClient, imageID).ExtractErr()
+	if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete a temporary %s image in the source cloud", imageID)
+	}
+}
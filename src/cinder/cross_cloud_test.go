@@ -0,0 +1,101 @@
+package cinder
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportFromSourceCloud(t *testing.T) {
+	sourceServer := th.SetupHTTP()
+	defer sourceServer.Teardown()
+	targetServer := th.SetupHTTP()
+	defer targetServer.Teardown()
+
+	imageID := "1bea47ed-f6a9-463b-b423-14b9cca9ad27"
+	importedID := "8c6ef58c-6d9b-4b7a-9d3a-5fe5ee9f1c3e"
+	data := make([]byte, 1000)
+	rand.Read(data)
+	var imported []byte
+	deleted := false
+
+	sourceServer.Mux.HandleFunc("/images/"+imageID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": "%s", "name": "backup", "status": "active", "disk_format": "raw", "container_format": "bare", "min_disk": 1, "size": 1000, "%sa": "b"}`, imageID, imageMetadataPrefix)
+	})
+	sourceServer.Mux.HandleFunc("/images/"+imageID+"/file", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Write(data)
+	})
+	targetServer.Mux.HandleFunc("/images/"+imageID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.WriteHeader(http.StatusNotFound)
+	})
+	targetServer.Mux.HandleFunc("/images", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		th.TestJSONRequest(t, r, fmt.Sprintf(`{"name": "backup", "visibility": "private", "disk_format": "raw", "container_format": "bare", "min_disk": 1, "%sa": "b"}`, imageMetadataPrefix))
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id": "%s", "status": "queued"}`, importedID)
+	})
+	targetServer.Mux.HandleFunc("/images/"+importedID, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		th.TestMethod(t, r, "DELETE")
+		deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+	targetServer.Mux.HandleFunc("/images/"+importedID+"/file", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "PUT")
+		imported, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	store := BlockStore{
+		client:    fakeClient.ServiceClient(targetServer),
+		imgClient: fakeClient.ServiceClient(targetServer),
+		log:       logrus.New(),
+		config:    map[string]string{"method": "image"},
+		// an inaccessible source cloud is skipped
+		sourceClouds: []string{"missing", "source"},
+		sourceCache:  &sourceStoreCache{},
+	}
+	source := store
+	source.client = fakeClient.ServiceClient(sourceServer)
+	source.imgClient = fakeClient.ServiceClient(sourceServer)
+	source.config = map[string]string{"method": "image", "cloud": "source"}
+	source.sourceClouds = nil
+	store.sourceCache.getOrCreate("source", "", func() (*BlockStore, error) {
+		return &source, nil
+	})
+
+	s, target, sourceID, err := store.forSourceCloud(utils.JoinMethod("image", imageID))
+	assert.NoError(t, err)
+	assert.Equal(t, &source, s)
+	assert.Equal(t, &store, target)
+	assert.Equal(t, imageID, sourceID)
+
+	id, cleanup, err := target.importFromSourceCloud(s, sourceID)
+	assert.NoError(t, err)
+	assert.Equal(t, importedID, id)
+	assert.Equal(t, data, imported)
+
+	cleanup()
+	assert.True(t, deleted)
+
+	// the snapshot exists in none of the clouds
+	s, _, _, err = store.forSourceCloud(utils.JoinMethod("image", importedID))
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+}
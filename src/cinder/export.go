@@ -0,0 +1,432 @@
+package cinder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/image/v2/imagedata"
+	"github.com/gophercloud/gophercloud/v2/openstack/image/v2/images"
+	"github.com/gophercloud/gophercloud/v2/openstack/objectstorage/v1/objects"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// exportPrefix is a Swift object name prefix of exported images
+	exportPrefix = "velero-image-exports/"
+	// defaultExportSegmentSize is a default size of exported image segments
+	defaultExportSegmentSize = "1Gi"
+)
+
+// exportManifest describes the exported image and its segments
+type exportManifest struct {
+	ImageID         string            `json:"image_id"`
+	Name            string            `json:"name"`
+	DiskFormat      string            `json:"disk_format"`
+	ContainerFormat string            `json:"container_format"`
+	MinDisk         int               `json:"min_disk"`
+	MinRAM          int               `json:"min_ram"`
+	Properties      map[string]string `json:"properties,omitempty"`
+	Compressed      bool              `json:"compressed"`
+	Encrypted       bool              `json:"encrypted"`
+	Segments        []exportSegment   `json:"segments"`
+}
+
+// exportSegment is a Swift object with a part of the exported image data
+type exportSegment struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func exportManifestName(imageID string) string {
+	return exportPrefix + imageID + "/manifest"
+}
+
+func exportSegmentName(imageID string, i int) string {
+	return fmt.Sprintf("%s%s/segment-%08d", exportPrefix, imageID, i)
+}
+
+// parseExportConfig parses the image export options
+func (b *BlockStore) parseExportConfig() error {
+	b.exportContainer = utils.GetConf(b.config, "exportContainer", "")
+	if b.exportContainer == "" {
+		return nil
+	}
+	if !b.usesMethod("image") {
+		return fmt.Errorf("exportContainer config option is not supported by %q snapshot method", b.config["method"])
+	}
+
+	segmentSize, err := resource.ParseQuantity(utils.GetConf(b.config, "exportSegmentSize", defaultExportSegmentSize))
+	if err != nil {
+		return fmt.Errorf("cannot parse exportSegmentSize config variable: %w", err)
+	}
+	b.exportSegmentSize = segmentSize.Value()
+	if b.exportSegmentSize <= 0 {
+		return fmt.Errorf("exportSegmentSize config variable must be positive")
+	}
+
+	b.exportCompression, err = strconv.ParseBool(utils.GetConf(b.config, "exportCompression", "false"))
+	if err != nil {
+		return fmt.Errorf("cannot parse exportCompression config variable: %w", err)
+	}
+
+	if key := utils.GetConf(b.config, "exportEncryptionKey", utils.GetEnv("OS_EXPORT_ENCRYPTION_KEY", "")); key != "" {
+		b.exportKey, err = utils.ParseEncryptionKey(key)
+		if err != nil {
+			return fmt.Errorf("cannot parse exportEncryptionKey config variable: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// initExportClient creates the object storage client of the export container,
+// the client authenticates against "exportCloud", when it's set
+func (b *BlockStore) initExportClient(logWithFields logrus.FieldLogger) error {
+	provider := b.provider
+	if cloud := b.config["exportCloud"]; cloud != "" {
+		config := map[string]string{
+			"cloud":     cloud,
+			"httpProxy": b.config["httpProxy"],
+			"noProxy":   b.config["noProxy"],
+		}
+		err := utils.Authenticate(&provider, "cinder", config, b.log)
+		if err != nil {
+			return fmt.Errorf("failed to authenticate against %v export cloud: %w", cloud, utils.WrapError(err))
+		}
+	}
+
+	exportRegion := utils.GetConf(b.config, "exportRegion", b.region)
+	var err error
+	b.exportClient, err = openstack.NewObjectStorageV1(provider, gophercloud.EndpointOpts{
+		Region:       exportRegion,
+		Availability: b.availability,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create export object storage client: %w", utils.WrapError(err))
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"exportEndpoint": b.exportClient.Endpoint,
+		"exportRegion":   exportRegion,
+	}).Info("Successfully created export object storage service client")
+	return nil
+}
+
+// exportImage streams the image data from Glance into segments in the export
+// Swift container, the data is optionally compressed and encrypted. The
+// uploaded segments are deleted, when the export fails.
+func (b *BlockStore) exportImage(logWithFields *logrus.Entry, imageID string) (err error) {
+	image, err := images.Get(context.TODO(), b.imgClient, imageID).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to get image %v: %w", imageID, utils.WrapError(err))
+	}
+
+	data, err := imagedata.Download(context.TODO(), b.imgClient, imageID).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to download image %v data: %w", imageID, utils.WrapError(err))
+	}
+	defer data.Close()
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		if err := b.deleteExport(logWithFields, imageID); err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete partially exported image")
+		}
+	}()
+
+	logWithFields.Infof("Exporting image into %v container", b.exportContainer)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(b.encodeExport(pw, data))
+	}()
+	defer pr.Close()
+
+	manifest := exportManifest{
+		ImageID:         image.ID,
+		Name:            image.Name,
+		DiskFormat:      image.DiskFormat,
+		ContainerFormat: image.ContainerFormat,
+		MinDisk:         image.MinDiskGigabytes,
+		MinRAM:          image.MinRAMMegabytes,
+		Properties:      make(map[string]string),
+		Compressed:      b.exportCompression,
+		Encrypted:       b.exportKey != nil,
+	}
+	for key, value := range image.Properties {
+		if v, ok := value.(string); ok && strings.HasPrefix(key, imageMetadataPrefix) {
+			manifest.Properties[key] = v
+		}
+	}
+
+	br := bufio.NewReader(pr)
+	for i := 0; ; i++ {
+		if _, err := br.Peek(1); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to export image %v data: %w", imageID, err)
+		}
+
+		segment, err := b.uploadExportSegment(exportSegmentName(imageID, i), io.LimitReader(br, b.exportSegmentSize))
+		if err != nil {
+			return err
+		}
+		manifest.Segments = append(manifest.Segments, segment)
+	}
+
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal image %v export manifest: %w", imageID, err)
+	}
+	opts := objects.CreateOpts{
+		Content:     bytes.NewReader(body),
+		ContentType: "application/json",
+	}
+	_, err = objects.Create(context.TODO(), b.exportClient, b.exportContainer, exportManifestName(imageID), opts).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to store image %v export manifest: %w", imageID, utils.WrapError(err))
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"exportContainer": b.exportContainer,
+		"segments":        len(manifest.Segments),
+	}).Info("Image was exported")
+	return nil
+}
+
+// encodeExport compresses and encrypts the image data
+func (b *BlockStore) encodeExport(w io.Writer, data io.Reader) error {
+	var closers []io.Closer
+	if b.exportKey != nil {
+		enc, err := utils.NewEncryptWriter(w, b.exportKey)
+		if err != nil {
+			return err
+		}
+		w = enc
+		closers = append(closers, enc)
+	}
+	if b.exportCompression {
+		gz := gzip.NewWriter(w)
+		w = gz
+		closers = append(closers, gz)
+	}
+
+	if _, err := io.Copy(w, data); err != nil {
+		return err
+	}
+	// close the outer writers first
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadExportSegment streams the segment into the export container
+func (b *BlockStore) uploadExportSegment(name string, data io.Reader) (exportSegment, error) {
+	counter := &countingWriter{Hash: sha256.New()}
+	opts := objects.CreateOpts{
+		Content:     io.TeeReader(data, counter),
+		ContentType: "application/octet-stream",
+		// the segment is verified using its SHA256 on import
+		NoETag: true,
+	}
+	_, err := objects.Create(context.TODO(), b.exportClient, b.exportContainer, name, opts).Extract()
+	if err != nil {
+		return exportSegment{}, fmt.Errorf("failed to upload %v export segment: %w", name, utils.WrapError(err))
+	}
+
+	return exportSegment{
+		Name:   name,
+		Size:   counter.size,
+		SHA256: hex.EncodeToString(counter.Sum(nil)),
+	}, nil
+}
+
+// importExportedImage creates a Glance image from the exported image data,
+// when the image doesn't exist anymore, and returns the ID of the image to
+// restore and whether it's a temporary imported image
+func (b *BlockStore) importExportedImage(logWithFields *logrus.Entry, imageID string) (string, bool, error) {
+	_, err := images.Get(context.TODO(), b.imgClient, imageID).Extract()
+	if err == nil {
+		return imageID, false, nil
+	}
+	if !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return "", false, fmt.Errorf("failed to get image %v: %w", imageID, utils.WrapError(err))
+	}
+
+	manifest, err := b.getExportManifest(imageID)
+	if err != nil {
+		return "", false, err
+	}
+	if manifest.Encrypted && b.exportKey == nil {
+		return "", false, fmt.Errorf("exported image %v is encrypted, but exportEncryptionKey config variable is not set", imageID)
+	}
+
+	logWithFields.Infof("Image doesn't exist, importing it from %v container", b.exportContainer)
+	visibility := images.ImageVisibilityPrivate
+	opts := images.CreateOpts{
+		Name:            manifest.Name,
+		DiskFormat:      manifest.DiskFormat,
+		ContainerFormat: manifest.ContainerFormat,
+		MinDisk:         manifest.MinDisk,
+		MinRAM:          manifest.MinRAM,
+		Visibility:      &visibility,
+		Properties:      manifest.Properties,
+	}
+	image, err := images.Create(context.TODO(), b.imgClient, opts).Extract()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create image for exported image %v: %w", imageID, utils.WrapError(err))
+	}
+
+	data, err := b.decodeExport(manifest)
+	if err == nil {
+		err = imagedata.Upload(context.TODO(), b.imgClient, image.ID, data).ExtractErr()
+		data.Close()
+	}
+	if err != nil {
+		if err := images.Delete(context.TODO(), b.imgClient, image.ID).ExtractErr(); err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete a temporary %s image", image.ID)
+		}
+		return "", false, fmt.Errorf("failed to import exported image %v: %w", imageID, utils.WrapError(err))
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"importedImageID": image.ID,
+	}).Info("Exported image was imported")
+	return image.ID, true, nil
+}
+
+func (b *BlockStore) getExportManifest(imageID string) (*exportManifest, error) {
+	res := objects.Download(context.TODO(), b.exportClient, b.exportContainer, exportManifestName(imageID), nil)
+	body, err := res.ExtractContent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image %v export manifest from %v container: %w", imageID, b.exportContainer, utils.WrapError(err))
+	}
+
+	manifest := &exportManifest{}
+	err = json.Unmarshal(body, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal image %v export manifest: %w", imageID, err)
+	}
+	return manifest, nil
+}
+
+// decodeExport returns a reader of the decrypted and decompressed image data
+// read from the export segments
+func (b *BlockStore) decodeExport(manifest *exportManifest) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(b.downloadExportSegments(pw, manifest.Segments))
+	}()
+
+	var r io.Reader = pr
+	if manifest.Encrypted {
+		dec, err := utils.NewDecryptReader(r, b.exportKey)
+		if err != nil {
+			pr.Close()
+			return nil, err
+		}
+		r = dec
+	}
+	if manifest.Compressed {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			pr.Close()
+			return nil, fmt.Errorf("failed to decompress exported image: %w", err)
+		}
+		r = gz
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, pr}, nil
+}
+
+// downloadExportSegments writes the verified segments data in order
+func (b *BlockStore) downloadExportSegments(w io.Writer, segments []exportSegment) error {
+	for _, segment := range segments {
+		res := objects.Download(context.TODO(), b.exportClient, b.exportContainer, segment.Name, nil)
+		if res.Err != nil {
+			return fmt.Errorf("failed to download %v export segment: %w", segment.Name, utils.WrapError(res.Err))
+		}
+
+		counter := &countingWriter{Hash: sha256.New()}
+		_, err := io.Copy(io.MultiWriter(w, counter), res.Body)
+		res.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to download %v export segment: %w", segment.Name, err)
+		}
+		if counter.size != segment.Size || hex.EncodeToString(counter.Sum(nil)) != segment.SHA256 {
+			return fmt.Errorf("%v export segment is corrupted", segment.Name)
+		}
+	}
+	return nil
+}
+
+// deleteExport deletes the exported image data and its manifest
+func (b *BlockStore) deleteExport(logWithFields *logrus.Entry, imageID string) error {
+	// list the objects, so segments of partially deleted exports are deleted
+	prefix := exportPrefix + imageID + "/"
+	pages, err := objects.List(b.exportClient, b.exportContainer, objects.ListOpts{Prefix: prefix}).AllPages(context.TODO())
+	if err != nil {
+		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to list exported objects of image %v: %w", imageID, utils.WrapError(err))
+	}
+	names, err := objects.ExtractNames(pages)
+	if err != nil {
+		return fmt.Errorf("failed to extract exported objects of image %v: %w", imageID, err)
+	}
+
+	// delete the manifest first, so partially deleted exports are not imported
+	sort.SliceStable(names, func(i, j int) bool {
+		return names[i] == exportManifestName(imageID)
+	})
+	for _, name := range names {
+		err := objects.Delete(context.TODO(), b.exportClient, b.exportContainer, name, nil).Err
+		if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			return fmt.Errorf("failed to delete %v exported object: %w", name, utils.WrapError(err))
+		}
+	}
+
+	if len(names) > 0 {
+		logWithFields.WithFields(logrus.Fields{
+			"exportContainer": b.exportContainer,
+		}).Info("Exported image was deleted")
+	}
+	return nil
+}
+
+// countingWriter hashes and counts the written data
+type countingWriter struct {
+	hash.Hash
+	size int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.size += int64(len(p))
+	return c.Hash.Write(p)
+}
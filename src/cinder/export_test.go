@@ -0,0 +1,144 @@
+package cinder
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImage(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	imageID := "1bea47ed-f6a9-463b-b423-14b9cca9ad27"
+	importedID := "8c6ef58c-6d9b-4b7a-9d3a-5fe5ee9f1c3e"
+	data := make([]byte, 1000)
+	rand.Read(data)
+	var imported []byte
+	stored := make(map[string][]byte)
+	deletedImages := make(map[string]bool)
+	failSegment := ""
+
+	fakeServer.Mux.HandleFunc("/images/"+imageID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		if deletedImages[imageID] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": "%s", "name": "backup", "status": "active", "disk_format": "raw", "container_format": "bare", "min_disk": 1, "%sa": "b"}`, imageID, imageMetadataPrefix)
+	})
+	fakeServer.Mux.HandleFunc("/images/"+imageID+"/file", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Write(data)
+	})
+	fakeServer.Mux.HandleFunc("/images", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		th.TestJSONRequest(t, r, fmt.Sprintf(`{"name": "backup", "visibility": "private", "disk_format": "raw", "container_format": "bare", "min_disk": 1, "%sa": "b"}`, imageMetadataPrefix))
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id": "%s", "status": "queued"}`, importedID)
+	})
+	fakeServer.Mux.HandleFunc("/images/"+importedID+"/file", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "PUT")
+		imported, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	fakeServer.Mux.HandleFunc("/swift/exports", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		var names []string
+		for name := range stored {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		w.Header().Add("Content-Type", "application/json")
+		if r.URL.Query().Get("marker") != "" {
+			names = nil
+		}
+		objects := []map[string]string{}
+		for _, name := range names {
+			objects = append(objects, map[string]string{"name": name})
+		}
+		json.NewEncoder(w).Encode(objects)
+	})
+	fakeServer.Mux.HandleFunc("/swift/exports/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/swift/exports/")
+		switch r.Method {
+		case "PUT":
+			if name == failSegment {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			stored[name], _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		case "GET":
+			body, ok := stored[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(body)
+		case "DELETE":
+			delete(stored, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	exportClient := fakeClient.ServiceClient(fakeServer)
+	exportClient.Endpoint += "swift/"
+	store := BlockStore{
+		imgClient:         fakeClient.ServiceClient(fakeServer),
+		exportClient:      exportClient,
+		log:               logrus.New(),
+		config:            map[string]string{"method": "image"},
+		exportContainer:   "exports",
+		exportSegmentSize: 300,
+		exportCompression: true,
+		exportKey:         bytes.Repeat([]byte{1}, 32),
+	}
+	logWithFields := store.log.WithFields(logrus.Fields{"imageID": imageID})
+
+	err := store.exportImage(logWithFields, imageID)
+	assert.NoError(t, err)
+	assert.Contains(t, stored, exportManifestName(imageID))
+	assert.Contains(t, stored, exportSegmentName(imageID, 0))
+	assert.NotContains(t, string(stored[exportSegmentName(imageID, 0)]), string(data[:16]))
+
+	// the image still exists
+	id, temporary, err := store.importExportedImage(logWithFields, imageID)
+	assert.NoError(t, err)
+	assert.Equal(t, imageID, id)
+	assert.False(t, temporary)
+
+	// the image was lost
+	deletedImages[imageID] = true
+	id, temporary, err = store.importExportedImage(logWithFields, imageID)
+	assert.NoError(t, err)
+	assert.Equal(t, importedID, id)
+	assert.True(t, temporary)
+	assert.Equal(t, data, imported)
+
+	err = store.deleteExport(logWithFields, imageID)
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+
+	// the uploaded segments are deleted, when the export fails
+	deletedImages[imageID] = false
+	failSegment = exportSegmentName(imageID, 1)
+	err = store.exportImage(logWithFields, imageID)
+	assert.Error(t, err)
+	assert.Empty(t, stored)
+}
@@ -0,0 +1,703 @@
+package cinder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	volumeGroupMicroversion    = "3.14"
+	defaultGroupSnapshotKey    = "openstack.velero.io/consistency-group"
+	groupSnapshotMemberKey     = "velero.io/group-snapshot-member"
+	groupSnapshotMemberCreated = "created"
+	groupSnapshotMemberTaken   = "claimed"
+	groupSnapshotMemberFreed   = "deleted"
+	// member snapshots, which are not taken by a backup within this time,
+	// are not expected to be taken anymore
+	groupSnapshotEntryTTL = time.Hour
+)
+
+var (
+	// active group and group snapshot statuses
+	//   https://github.com/openstack/cinder/blob/master/api-ref/source/v3/groups.inc
+	groupStatuses = []string{
+		"available",
+	}
+)
+
+// group is a Cinder generic volume group
+type group struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// groupSnapshot is a Cinder generic volume group snapshot
+type groupSnapshot struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	GroupID string `json:"group_id"`
+}
+
+// volumeGroup identifies PVCs, which must be snapshotted together
+type volumeGroup struct {
+	namespace string
+	name      string
+}
+
+// groupSnapshotEntry holds member snapshots of a group snapshot created for
+// a single Velero backup
+type groupSnapshotEntry struct {
+	once            sync.Once
+	created         time.Time
+	store           *BlockStore
+	groupSnapshotID string
+	snapshots       map[string]string
+	metadata        map[string]map[string]string
+	err             error
+}
+
+// snapshotMetadataListOpts filters snapshots by metadata on the server side
+// using the Cinder metadata filter
+type snapshotMetadataListOpts map[string]string
+
+func (opts snapshotMetadataListOpts) ToSnapshotListQuery() (string, error) {
+	metadata, err := json.Marshal(map[string]string(opts))
+	if err != nil {
+		return "", err
+	}
+	return "?" + url.Values{"metadata": []string{string(metadata)}}.Encode(), nil
+}
+
+// groupSnapshotCache holds the PVC groups of the volumes seen by GetVolumeID
+// and the group snapshots created by CreateSnapshot
+type groupSnapshotCache struct {
+	mu      sync.Mutex
+	volumes map[string]volumeGroup
+	entries map[string]*groupSnapshotEntry
+}
+
+func (c *groupSnapshotCache) setVolumeGroup(volumeID string, g volumeGroup) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.volumes == nil {
+		c.volumes = make(map[string]volumeGroup)
+	}
+	c.volumes[volumeID] = g
+}
+
+func (c *groupSnapshotCache) volumeGroup(volumeID string) (volumeGroup, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g, ok := c.volumes[volumeID]
+	return g, ok
+}
+
+func (c *groupSnapshotCache) entry(key string) *groupSnapshotEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*groupSnapshotEntry)
+	}
+	e, ok := c.entries[key]
+	if !ok {
+		e = &groupSnapshotEntry{created: time.Now()}
+		c.entries[key] = e
+	}
+	return e
+}
+
+// evict forgets the group snapshot entry, so the next backup with the same
+// key creates a new group snapshot
+func (c *groupSnapshotCache) evict(key string, e *groupSnapshotEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[key] == e {
+		delete(c.entries, key)
+	}
+}
+
+// evictStale forgets and returns the group snapshot entries older than the
+// ttl, whose member snapshots were not all taken
+func (c *groupSnapshotCache) evictStale(ttl time.Duration) []*groupSnapshotEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var stale []*groupSnapshotEntry
+	for key, e := range c.entries {
+		if time.Since(e.created) > ttl {
+			stale = append(stale, e)
+			delete(c.entries, key)
+		}
+	}
+	return stale
+}
+
+// take returns the member snapshot of the volume and forgets the group
+// snapshot, when all its members were returned
+func (c *groupSnapshotCache) take(key string, e *groupSnapshotEntry, volumeID string) (string, map[string]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshotID, ok := e.snapshots[volumeID]
+	if !ok {
+		return "", nil, false
+	}
+	delete(e.snapshots, volumeID)
+	if len(e.snapshots) == 0 {
+		delete(c.entries, key)
+	}
+	return snapshotID, e.metadata[volumeID], true
+}
+
+// getVolumeGroup returns the PVC group of the persistent volume defined by
+// the groupSnapshotKey label of the bound PVC
+func (b *BlockStore) getVolumeGroup(pv *v1.PersistentVolume) (volumeGroup, bool, error) {
+	if pv.Spec.ClaimRef == nil {
+		return volumeGroup{}, false, nil
+	}
+
+	pvc, err := b.kubeClient.CoreV1().PersistentVolumeClaims(pv.Spec.ClaimRef.Namespace).Get(context.TODO(), pv.Spec.ClaimRef.Name, metav1.GetOptions{})
+	if err != nil {
+		return volumeGroup{}, false, fmt.Errorf("failed to get %s/%s PVC: %w", pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name, err)
+	}
+
+	name := pvc.Labels[b.groupSnapshotKey]
+	if name == "" {
+		return volumeGroup{}, false, nil
+	}
+
+	return volumeGroup{namespace: pvc.Namespace, name: name}, true, nil
+}
+
+// getGroupVolumeIDs returns Cinder volume IDs of all bound PVCs in the group
+func (b *BlockStore) getGroupVolumeIDs(g volumeGroup) ([]string, error) {
+	selector := labels.SelectorFromSet(labels.Set{b.groupSnapshotKey: g.name}).String()
+	pvcs, err := b.kubeClient.CoreV1().PersistentVolumeClaims(g.namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVCs in %s namespace with %q selector: %w", g.namespace, selector, err)
+	}
+
+	var volumeIDs []string
+	for _, pvc := range pvcs.Items {
+		if pvc.Spec.VolumeName == "" {
+			continue
+		}
+		pv, err := b.kubeClient.CoreV1().PersistentVolumes().Get(context.TODO(), pvc.Spec.VolumeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s PV: %w", pvc.Spec.VolumeName, err)
+		}
+		if volumeID := getPVVolumeID(pv); volumeID != "" {
+			volumeIDs = append(volumeIDs, volumeID)
+		}
+	}
+
+	return volumeIDs, nil
+}
+
+// createGroupSnapshotMember snapshots all volumes of the volume PVC group at
+// once and returns the volume member snapshot. The group snapshot is created
+// only once per Velero backup, other volumes of the group get their member
+// snapshots from the cache. It returns false, when the volume must be
+// snapshotted separately.
+func (b *BlockStore) createGroupSnapshotMember(volumeID, volumeAZ string, tags map[string]string) (string, bool, error) {
+	g, ok := b.groupCache.volumeGroup(volumeID)
+	if !ok {
+		return "", false, nil
+	}
+
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"volumeID":  volumeID,
+		"volumeAZ":  volumeAZ,
+		"namespace": g.namespace,
+		"group":     g.name,
+		"method":    b.config["method"],
+	})
+	logWithFields.Info("BlockStore.CreateSnapshot called")
+
+	b.releaseStaleGroupSnapshots()
+
+	key := strings.Join([]string{tags["velero.io/backup"], b.config["trustID"], g.namespace, g.name}, "/")
+	e := b.groupCache.entry(key)
+	e.once.Do(func() {
+		e.store = b
+		e.groupSnapshotID, e.snapshots, e.metadata, e.err = b.createGroupSnapshot(logWithFields, g, volumeAZ, tags)
+	})
+	if e.err != nil {
+		// a retried backup must not get the same error
+		b.groupCache.evict(key, e)
+		return "", true, e.err
+	}
+
+	snapshotID, metadata, ok := b.groupCache.take(key, e, volumeID)
+	if !ok {
+		logWithFields.Warn("volume is not a member of the group snapshot, creating a separate snapshot")
+		return "", false, nil
+	}
+
+	// mark the member snapshot as used by the Velero backup
+	opts := snapshots.UpdateMetadataOpts{Metadata: make(map[string]any)}
+	for k, v := range utils.Merge(metadata, tags, map[string]string{groupSnapshotMemberKey: groupSnapshotMemberTaken}) {
+		opts.Metadata[k] = v
+	}
+	_, err := snapshots.UpdateMetadata(context.TODO(), b.client, snapshotID, opts).Extract()
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to update member snapshot metadata")
+		return snapshotID, true, fmt.Errorf("failed to update member snapshot %v metadata: %w", snapshotID, utils.WrapError(err))
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"snapshotID": snapshotID,
+	}).Info("Group snapshot member finished successfuly")
+	return snapshotID, true, nil
+}
+
+// releaseStaleGroupSnapshots forgets group snapshots with member snapshots
+// not taken by any backup and releases the members. Group snapshots, which
+// have no member snapshot used by a backup, are deleted. Member snapshots of
+// the other group snapshots are deleted together with the last used member
+// snapshot.
+func (b *BlockStore) releaseStaleGroupSnapshots() {
+	for _, e := range b.groupCache.evictStale(groupSnapshotEntryTTL) {
+		if e.groupSnapshotID == "" {
+			continue
+		}
+		logWithFields := b.log.WithFields(logrus.Fields{
+			"groupSnapshotID": e.groupSnapshotID,
+			"members":         e.snapshots,
+		})
+		logWithFields.Warn("member snapshots were not taken by any backup, releasing the group snapshot")
+		var snapshotIDs []string
+		for _, id := range e.snapshots {
+			snapshotIDs = append(snapshotIDs, id)
+		}
+		if err := e.store.releaseGroupSnapshotMembers(logWithFields, e.groupSnapshotID, snapshotIDs); err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to release %s group snapshot: %v", e.groupSnapshotID, err)
+		}
+	}
+}
+
+// reclaimGroupSnapshots releases member snapshots, which were not taken by
+// any backup within the ttl, e.g. when the plugin exited before the backup
+// took them. The members are found by the Cinder metadata, so group
+// snapshots created by previous plugin processes are released as well.
+func (b *BlockStore) reclaimGroupSnapshots(logWithFields *logrus.Entry, ttl time.Duration) error {
+	g := b.withGroupMicroversion()
+	if g == nil {
+		return nil
+	}
+
+	listOpts := snapshotMetadataListOpts{groupSnapshotMemberKey: groupSnapshotMemberCreated}
+	allPages, err := snapshots.List(g.client, listOpts).AllPages(context.TODO())
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", utils.WrapError(err))
+	}
+	allSnapshots, err := snapshots.ExtractSnapshots(allPages)
+	if err != nil {
+		return fmt.Errorf("failed to extract snapshots: %w", err)
+	}
+
+	members := make(map[string][]string)
+	for _, s := range allSnapshots {
+		// the metadata filter may be ignored by older Cinder versions
+		if s.GroupSnapshotID == "" || s.Metadata[groupSnapshotMemberKey] != groupSnapshotMemberCreated || time.Since(s.CreatedAt) < ttl {
+			continue
+		}
+		members[s.GroupSnapshotID] = append(members[s.GroupSnapshotID], s.ID)
+	}
+
+	var errs []error
+	for groupSnapshotID, snapshotIDs := range members {
+		logWithFields := logWithFields.WithFields(logrus.Fields{
+			"groupSnapshotID": groupSnapshotID,
+			"members":         snapshotIDs,
+		})
+		logWithFields.Warn("member snapshots were not taken by any backup, releasing the group snapshot")
+		if err := g.releaseGroupSnapshotMembers(logWithFields, groupSnapshotID, snapshotIDs); err != nil {
+			errs = append(errs, fmt.Errorf("failed to release %s group snapshot: %w", groupSnapshotID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// releaseGroupSnapshotMembers marks the member snapshots, which will never be
+// taken by a backup, as deleted and releases the group snapshot
+func (b *BlockStore) releaseGroupSnapshotMembers(logWithFields *logrus.Entry, groupSnapshotID string, snapshotIDs []string) error {
+	for _, id := range snapshotIDs {
+		opts := snapshots.UpdateMetadataOpts{Metadata: map[string]any{groupSnapshotMemberKey: groupSnapshotMemberFreed}}
+		_, err := snapshots.UpdateMetadata(context.TODO(), b.client, id, opts).Extract()
+		if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			return fmt.Errorf("failed to update member snapshot %v metadata: %w", id, utils.WrapError(err))
+		}
+	}
+
+	return b.releaseGroupSnapshot(logWithFields, groupSnapshotID)
+}
+
+// createGroupSnapshot adds the group volumes into a temporary Cinder group,
+// snapshots the group and returns the group snapshot ID, the member snapshot
+// IDs and the volume metadata mapped by the volume IDs
+func (b *BlockStore) createGroupSnapshot(logWithFields *logrus.Entry, g volumeGroup, volumeAZ string, tags map[string]string) (string, map[string]string, map[string]map[string]string, error) {
+	volumeIDs, err := b.getGroupVolumeIDs(g)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var volumeTypes []string
+	metadata := make(map[string]map[string]string, len(volumeIDs))
+	for _, id := range volumeIDs {
+		volume, err := volumes.Get(context.TODO(), b.client, id).Extract()
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get volume from cinder")
+			return "", nil, nil, fmt.Errorf("failed to get volume %v from cinder: %w", id, utils.WrapError(err))
+		}
+		if !utils.SliceContains(volumeTypes, volume.VolumeType) {
+			volumeTypes = append(volumeTypes, volume.VolumeType)
+		}
+		if volumeAZ == "" {
+			volumeAZ = volume.AvailabilityZone
+		}
+		metadata[id] = volume.Metadata
+	}
+
+	groupName := fmt.Sprintf("%s.group.%s", g.name, strconv.FormatUint(utils.Rand.Uint64(), 10))
+	logWithFields = logWithFields.WithFields(logrus.Fields{
+		"groupName":   groupName,
+		"volumeIDs":   volumeIDs,
+		"volumeTypes": volumeTypes,
+	})
+
+	grp, err := b.createGroup(groupName, volumeTypes, volumeAZ)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create volume group")
+		return "", nil, nil, fmt.Errorf("failed to create volume group %v: %w", groupName, utils.WrapError(err))
+	}
+	_, err = b.waitForGroupStatus(grp.ID, groupStatuses, b.volumeTimeout)
+	if err != nil {
+		b.cleanupGroup(logWithFields, grp.ID, nil)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("volume group didn't get into 'available' state within the time limit")
+		return "", nil, nil, fmt.Errorf("volume group %v didn't get into 'available' state within the time limit: %w", grp.ID, utils.WrapError(err))
+	}
+
+	err = b.updateGroupVolumes(grp.ID, volumeIDs, nil)
+	if err == nil {
+		_, err = b.waitForGroupStatus(grp.ID, groupStatuses, b.volumeTimeout)
+	}
+	if err != nil {
+		b.cleanupGroup(logWithFields, grp.ID, volumeIDs)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to add volumes to volume group")
+		return "", nil, nil, fmt.Errorf("failed to add volumes to volume group %v: %w", grp.ID, utils.WrapError(err))
+	}
+
+	gs, err := b.createGroupSnapshotOfGroup(grp.ID, groupName)
+	if err != nil {
+		b.cleanupGroup(logWithFields, grp.ID, volumeIDs)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create group snapshot")
+		return "", nil, nil, fmt.Errorf("failed to create group snapshot of volume group %v: %w", grp.ID, utils.WrapError(err))
+	}
+
+	logWithFields = logWithFields.WithFields(logrus.Fields{
+		"groupID":         grp.ID,
+		"groupSnapshotID": gs.ID,
+	})
+	_, err = b.waitForGroupSnapshotStatus(gs.ID, groupStatuses, b.snapshotTimeout)
+
+	// volumes must leave the temporary group to be grouped by next backups,
+	// the group itself is deleted together with the group snapshot
+	if e := b.updateGroupVolumes(grp.ID, nil, volumeIDs); e != nil {
+		logWithFields.WithFields(utils.ErrorFields(e)).Errorf("failed to remove volumes from %s volume group: %v", grp.ID, e)
+	} else if _, e := b.waitForGroupStatus(grp.ID, groupStatuses, b.volumeTimeout); e != nil {
+		logWithFields.WithFields(utils.ErrorFields(e)).Errorf("volume group %s didn't get into 'available' state within the time limit: %v", grp.ID, e)
+	}
+
+	if err != nil {
+		b.cleanupGroupSnapshot(logWithFields, gs)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("group snapshot didn't get into 'available' state within the time limit")
+		return "", nil, nil, fmt.Errorf("group snapshot %v didn't get into 'available' state within the time limit: %w", gs.ID, utils.WrapError(err))
+	}
+
+	members := make(map[string]string, len(volumeIDs))
+	for _, id := range volumeIDs {
+		allPages, err := snapshots.List(b.client, snapshots.ListOpts{VolumeID: id}).AllPages(context.TODO())
+		if err != nil {
+			b.cleanupGroupSnapshot(logWithFields, gs)
+			return "", nil, nil, fmt.Errorf("failed to list %s volume snapshots: %w", id, utils.WrapError(err))
+		}
+		allSnapshots, err := snapshots.ExtractSnapshots(allPages)
+		if err != nil {
+			b.cleanupGroupSnapshot(logWithFields, gs)
+			return "", nil, nil, fmt.Errorf("failed to extract %s volume snapshots: %w", id, err)
+		}
+		for _, s := range allSnapshots {
+			if s.GroupSnapshotID == gs.ID {
+				members[id] = s.ID
+				break
+			}
+		}
+	}
+
+	// unclaimed member snapshots are found by the metadata and released,
+	// when no backup takes them
+	for _, snapshotID := range members {
+		opts := snapshots.UpdateMetadataOpts{Metadata: map[string]any{groupSnapshotMemberKey: groupSnapshotMemberCreated}}
+		_, err = snapshots.UpdateMetadata(context.TODO(), b.client, snapshotID, opts).Extract()
+		if err != nil {
+			b.cleanupGroupSnapshot(logWithFields, gs)
+			return "", nil, nil, fmt.Errorf("failed to update member snapshot %v metadata: %w", snapshotID, utils.WrapError(err))
+		}
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"members": members,
+	}).Info("Group snapshot finished successfuly")
+	return gs.ID, members, metadata, nil
+}
+
+// deleteGroupSnapshotMember marks the member snapshot as deleted and deletes
+// the group snapshot and the group, when all member snapshots used by Velero
+// backups are deleted
+func (b *BlockStore) deleteGroupSnapshotMember(logWithFields *logrus.Entry, snapshot *snapshots.Snapshot) error {
+	logWithFields = logWithFields.WithField("groupSnapshotID", snapshot.GroupSnapshotID)
+
+	opts := snapshots.UpdateMetadataOpts{Metadata: make(map[string]any)}
+	for k, v := range utils.Merge(snapshot.Metadata, map[string]string{groupSnapshotMemberKey: groupSnapshotMemberFreed}) {
+		opts.Metadata[k] = v
+	}
+	_, err := snapshots.UpdateMetadata(context.TODO(), b.client, snapshot.ID, opts).Extract()
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to update member snapshot metadata")
+		return fmt.Errorf("failed to update member snapshot %v metadata: %w", snapshot.ID, utils.WrapError(err))
+	}
+
+	return b.releaseGroupSnapshot(logWithFields, snapshot.GroupSnapshotID)
+}
+
+// releaseGroupSnapshot deletes the group snapshot and the group, when none of
+// its member snapshots is used by Velero backups
+func (b *BlockStore) releaseGroupSnapshot(logWithFields *logrus.Entry, groupSnapshotID string) error {
+	listOpts := snapshotMetadataListOpts{groupSnapshotMemberKey: groupSnapshotMemberTaken}
+	allPages, err := snapshots.List(b.client, listOpts).AllPages(context.TODO())
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", utils.WrapError(err))
+	}
+	allSnapshots, err := snapshots.ExtractSnapshots(allPages)
+	if err != nil {
+		return fmt.Errorf("failed to extract snapshots: %w", err)
+	}
+	for _, s := range allSnapshots {
+		// the metadata filter may be ignored by older Cinder versions
+		if s.GroupSnapshotID == groupSnapshotID && s.Metadata[groupSnapshotMemberKey] == groupSnapshotMemberTaken {
+			logWithFields.Infof("group snapshot is still used by %s member snapshot", s.ID)
+			return nil
+		}
+	}
+
+	gs, err := b.getGroupSnapshot(groupSnapshotID)
+	if err != nil {
+		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			logWithFields.Info("group snapshot is already deleted")
+			return nil
+		}
+		return fmt.Errorf("failed to get group snapshot %v: %w", groupSnapshotID, utils.WrapError(err))
+	}
+
+	err = b.deleteGroupSnapshot(gs.ID)
+	if err == nil {
+		_, err = b.waitForGroupSnapshotStatus(gs.ID, []string{"deleted"}, b.snapshotTimeout)
+	}
+	if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete group snapshot")
+		return fmt.Errorf("failed to delete group snapshot %v: %w", gs.ID, utils.WrapError(err))
+	}
+
+	err = b.deleteGroup(gs.GroupID)
+	if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete volume group")
+		return fmt.Errorf("failed to delete volume group %v: %w", gs.GroupID, utils.WrapError(err))
+	}
+
+	logWithFields.Info("Group snapshot was deleted")
+	return nil
+}
+
+// cleanupGroupSnapshot deletes the group snapshot and the group of a failed
+// group snapshot
+func (b *BlockStore) cleanupGroupSnapshot(logWithFields *logrus.Entry, gs *groupSnapshot) {
+	err := b.deleteGroupSnapshot(gs.ID)
+	if err == nil {
+		_, err = b.waitForGroupSnapshotStatus(gs.ID, []string{"deleted"}, b.snapshotTimeout)
+	}
+	if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete %s group snapshot: %v", gs.ID, err)
+	}
+	if err := b.deleteGroup(gs.GroupID); err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete %s volume group: %v", gs.GroupID, err)
+	}
+}
+
+// withGroupMicroversion returns a copy of the BlockStore with a Cinder
+// microversion supporting groups, so member snapshots can be deleted even
+// when group snapshots are disabled. Nil is returned, when Cinder doesn't
+// support groups.
+func (b *BlockStore) withGroupMicroversion() *BlockStore {
+	if !b.groupsSupported {
+		return nil
+	}
+	if ok, _ := utils.CompareMicroversions("lte", volumeGroupMicroversion, b.client.Microversion); ok {
+		return b
+	}
+	client := *b.client
+	client.Microversion = volumeGroupMicroversion
+	s := *b
+	s.client = &client
+	return &s
+}
+
+// cleanupGroup removes the volumes from the group and deletes the group
+func (b *BlockStore) cleanupGroup(logWithFields *logrus.Entry, groupID string, volumeIDs []string) {
+	if len(volumeIDs) > 0 {
+		if err := b.updateGroupVolumes(groupID, nil, volumeIDs); err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to remove volumes from %s volume group: %v", groupID, err)
+		}
+		if _, err := b.waitForGroupStatus(groupID, groupStatuses, b.volumeTimeout); err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("volume group %s didn't get into 'available' state within the time limit: %v", groupID, err)
+		}
+	}
+	if err := b.deleteGroup(groupID); err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete %s volume group: %v", groupID, err)
+	}
+}
+
+func (b *BlockStore) createGroup(name string, volumeTypes []string, availabilityZone string) (*group, error) {
+	req := map[string]any{
+		"group": map[string]any{
+			"name":              name,
+			"description":       "Velero temporary volume group",
+			"group_type":        b.groupType,
+			"volume_types":      volumeTypes,
+			"availability_zone": availabilityZone,
+		},
+	}
+	var resp struct {
+		Group group `json:"group"`
+	}
+	_, err := b.client.Post(context.TODO(), b.client.ServiceURL("groups"), req, &resp, &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Group, nil
+}
+
+func (b *BlockStore) getGroup(id string) (*group, error) {
+	var resp struct {
+		Group group `json:"group"`
+	}
+	_, err := b.client.Get(context.TODO(), b.client.ServiceURL("groups", id), &resp, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Group, nil
+}
+
+func (b *BlockStore) updateGroupVolumes(id string, addVolumes, removeVolumes []string) error {
+	opts := map[string]any{}
+	if len(addVolumes) > 0 {
+		opts["add_volumes"] = strings.Join(addVolumes, ",")
+	}
+	if len(removeVolumes) > 0 {
+		opts["remove_volumes"] = strings.Join(removeVolumes, ",")
+	}
+	_, err := b.client.Put(context.TODO(), b.client.ServiceURL("groups", id), map[string]any{"group": opts}, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	return err
+}
+
+func (b *BlockStore) deleteGroup(id string) error {
+	req := map[string]any{
+		"delete": map[string]any{
+			"delete-volumes": false,
+		},
+	}
+	_, err := b.client.Post(context.TODO(), b.client.ServiceURL("groups", id, "action"), req, nil, &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	return err
+}
+
+func (b *BlockStore) createGroupSnapshotOfGroup(groupID, name string) (*groupSnapshot, error) {
+	req := map[string]any{
+		"group_snapshot": map[string]any{
+			"group_id":    groupID,
+			"name":        name,
+			"description": "Velero group snapshot",
+		},
+	}
+	var resp struct {
+		GroupSnapshot groupSnapshot `json:"group_snapshot"`
+	}
+	_, err := b.client.Post(context.TODO(), b.client.ServiceURL("group_snapshots"), req, &resp, &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp.GroupSnapshot, nil
+}
+
+func (b *BlockStore) getGroupSnapshot(id string) (*groupSnapshot, error) {
+	var resp struct {
+		GroupSnapshot groupSnapshot `json:"group_snapshot"`
+	}
+	_, err := b.client.Get(context.TODO(), b.client.ServiceURL("group_snapshots", id), &resp, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.GroupSnapshot, nil
+}
+
+func (b *BlockStore) deleteGroupSnapshot(id string) error {
+	_, err := b.client.Delete(context.TODO(), b.client.ServiceURL("group_snapshots", id), &gophercloud.RequestOpts{
+		OkCodes: []int{202},
+	})
+	return err
+}
+
+func (b *BlockStore) waitForGroupStatus(id string, statuses []string, secs int) (current *group, err error) {
+	return current, utils.WaitForStatus(statuses, secs, func() (string, error) {
+		current, err = b.getGroup(id)
+		if err != nil {
+			return "", err
+		}
+		return current.Status, nil
+	})
+}
+
+func (b *BlockStore) waitForGroupSnapshotStatus(id string, statuses []string, secs int) (current *groupSnapshot, err error) {
+	return current, utils.WaitForStatus(statuses, secs, func() (string, error) {
+		current, err = b.getGroupSnapshot(id)
+		if err != nil {
+			return "", err
+		}
+		return current.Status, nil
+	})
+}
@@ -0,0 +1,389 @@
+package cinder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeGroupCinder is a minimal stateful Cinder API serving generic volume
+// groups and group snapshots
+type fakeGroupCinder struct {
+	mu              sync.Mutex
+	groupVolumes    []string
+	groupDeleted    bool
+	snapshotDeleted bool
+	failGroups      int
+	snapshots       map[string]map[string]any
+}
+
+func (f *fakeGroupCinder) handle(t *testing.T, fakeServer th.FakeServer, volumeIDs []string) {
+	f.snapshots = make(map[string]map[string]any)
+
+	for _, id := range volumeIDs {
+		fakeServer.Mux.HandleFunc("/volumes/"+id, func(w http.ResponseWriter, r *http.Request) {
+			th.TestMethod(t, r, "GET")
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"volume": {"id": "%s", "status": "in-use", "volume_type": "ssd", "availability_zone": "nova", "metadata": {"app": "db"}}}`, id)
+		})
+	}
+
+	fakeServer.Mux.HandleFunc("/groups", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		var req struct {
+			Group struct {
+				Name             string   `json:"name"`
+				GroupType        string   `json:"group_type"`
+				VolumeTypes      []string `json:"volume_types"`
+				AvailabilityZone string   `json:"availability_zone"`
+			} `json:"group"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.failGroups > 0 {
+			f.failGroups--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		assert.Regexp(t, `^db\.group\.\d+$`, req.Group.Name)
+		assert.Equal(t, "consistent", req.Group.GroupType)
+		assert.Equal(t, []string{"ssd"}, req.Group.VolumeTypes)
+		assert.Equal(t, "nova", req.Group.AvailabilityZone)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"group": {"id": "g1", "status": "creating"}}`)
+	})
+	fakeServer.Mux.HandleFunc("/groups/g1", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch r.Method {
+		case "GET":
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprint(w, `{"group": {"id": "g1", "status": "available"}}`)
+		case "PUT":
+			var req struct {
+				Group struct {
+					AddVolumes    string `json:"add_volumes"`
+					RemoveVolumes string `json:"remove_volumes"`
+				} `json:"group"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			if req.Group.AddVolumes != "" {
+				f.groupVolumes = strings.Split(req.Group.AddVolumes, ",")
+			}
+			if req.Group.RemoveVolumes != "" {
+				f.groupVolumes = nil
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+	fakeServer.Mux.HandleFunc("/groups/g1/action", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		th.TestJSONRequest(t, r, `{"delete": {"delete-volumes": false}}`)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.groupDeleted = true
+		w.WriteHeader(http.StatusAccepted)
+	})
+	fakeServer.Mux.HandleFunc("/group_snapshots", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for i, id := range f.groupVolumes {
+			f.snapshots[fmt.Sprintf("s%d", i)] = map[string]any{
+				"id":                fmt.Sprintf("s%d", i),
+				"volume_id":         id,
+				"status":            "available",
+				"group_snapshot_id": "gs1",
+				"metadata":          map[string]string{},
+				"created_at":        time.Now().UTC().Format(gophercloud.RFC3339MilliNoZ),
+			}
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"group_snapshot": {"id": "gs1", "group_id": "g1", "status": "creating"}}`)
+	})
+	fakeServer.Mux.HandleFunc("/group_snapshots/gs1", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch r.Method {
+		case "GET":
+			if f.snapshotDeleted {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprint(w, `{"group_snapshot": {"id": "gs1", "group_id": "g1", "status": "available"}}`)
+		case "DELETE":
+			f.snapshotDeleted = true
+			f.snapshots = map[string]map[string]any{}
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+	fakeServer.Mux.HandleFunc("/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var filter map[string]string
+		if m := r.URL.Query().Get("metadata"); m != "" {
+			assert.NoError(t, json.Unmarshal([]byte(m), &filter))
+		}
+		var list []map[string]any
+		for _, s := range f.snapshots {
+			if v := r.URL.Query().Get("volume_id"); v != "" && v != s["volume_id"] {
+				continue
+			}
+			if v, ok := filter[groupSnapshotMemberKey]; ok && v != s["metadata"].(map[string]string)[groupSnapshotMemberKey] {
+				continue
+			}
+			list = append(list, s)
+		}
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"snapshots": list})
+	})
+	fakeServer.Mux.HandleFunc("/snapshots/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		id := strings.Split(strings.TrimPrefix(r.URL.Path, "/snapshots/"), "/")[0]
+		s, ok := f.snapshots[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET":
+			json.NewEncoder(w).Encode(map[string]any{"snapshot": s})
+		case r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/metadata"):
+			var req map[string]map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			s["metadata"] = req["metadata"]
+			json.NewEncoder(w).Encode(req)
+		default:
+			t.Errorf("unexpected %s %s request", r.Method, r.URL.Path)
+		}
+	})
+}
+
+func newGroupPVC(name, volumeName, group string) (*v1.PersistentVolumeClaim, *v1.PersistentVolume) {
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "app"},
+		Spec:       v1.PersistentVolumeClaimSpec{VolumeName: name},
+	}
+	if group != "" {
+		pvc.Labels = map[string]string{defaultGroupSnapshotKey: group}
+	}
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{Driver: "cinder.csi.openstack.org", VolumeHandle: volumeName},
+			},
+			ClaimRef: &v1.ObjectReference{Namespace: "app", Name: name},
+		},
+	}
+	return pvc, pv
+}
+
+func TestGroupSnapshots(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	volumeIDs := []string{"7d3b2c5e-0d55-4b9a-9f6d-3f0d7d7e9a01", "7d3b2c5e-0d55-4b9a-9f6d-3f0d7d7e9a02"}
+	// a group member, which is not included in the backup
+	excludedID := "7d3b2c5e-0d55-4b9a-9f6d-3f0d7d7e9a04"
+	cinder := &fakeGroupCinder{failGroups: 1}
+	cinder.handle(t, fakeServer, append(volumeIDs, excludedID))
+
+	data, dataPV := newGroupPVC("data", volumeIDs[0], "db")
+	wal, walPV := newGroupPVC("wal", volumeIDs[1], "db")
+	other, otherPV := newGroupPVC("other", "7d3b2c5e-0d55-4b9a-9f6d-3f0d7d7e9a03", "")
+	excluded, excludedPV := newGroupPVC("excluded", excludedID, "db")
+
+	store := BlockStore{
+		client:           fakeClient.ServiceClient(fakeServer),
+		log:              logrus.New(),
+		config:           map[string]string{"method": "snapshot"},
+		groupSnapshots:   true,
+		groupSnapshotKey: defaultGroupSnapshotKey,
+		groupType:        "consistent",
+		groupCache:       &groupSnapshotCache{},
+		groupsSupported:  true,
+		kubeClient:       fake.NewClientset(data, dataPV, wal, walPV, other, otherPV, excluded, excludedPV),
+		volumeTimeout:    3,
+		snapshotTimeout:  3,
+	}
+
+	for _, pv := range []*v1.PersistentVolume{dataPV, walPV, otherPV} {
+		g, ok, err := store.getVolumeGroup(pv)
+		assert.NoError(t, err)
+		if ok {
+			store.groupCache.setVolumeGroup(pv.Spec.CSI.VolumeHandle, g)
+		}
+	}
+	_, ok := store.groupCache.volumeGroup(otherPV.Spec.CSI.VolumeHandle)
+	assert.False(t, ok)
+
+	tags := map[string]string{"velero.io/backup": "daily"}
+
+	// the failed group snapshot is not reused by the retried backup
+	_, ok, err := store.createGroupSnapshotMember(volumeIDs[0], "", tags)
+	assert.Error(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, store.groupCache.entries)
+
+	snapshotIDs := make(map[string]bool)
+	for _, id := range volumeIDs {
+		snapshotID, ok, err := store.createGroupSnapshotMember(id, "", tags)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		snapshotIDs[snapshotID] = true
+	}
+	// the PVCs are listed by name, s1 is the member of the excluded volume
+	assert.Equal(t, map[string]bool{"s0": true, "s2": true}, snapshotIDs)
+	assert.Empty(t, cinder.groupVolumes, "volumes must be removed from the temporary group")
+	for _, id := range []string{"s0", "s2"} {
+		metadata := cinder.snapshots[id]["metadata"].(map[string]string)
+		assert.Equal(t, groupSnapshotMemberTaken, metadata[groupSnapshotMemberKey])
+		assert.Equal(t, "db", metadata["app"])
+	}
+
+	// the member snapshot of the excluded volume is never taken, the group
+	// snapshot is kept for the taken members
+	assert.Len(t, store.groupCache.entries, 1)
+	for _, e := range store.groupCache.entries {
+		e.created = time.Now().Add(-2 * groupSnapshotEntryTTL)
+	}
+	store.releaseStaleGroupSnapshots()
+	assert.Empty(t, store.groupCache.entries)
+	assert.False(t, cinder.snapshotDeleted)
+
+	// member snapshots are deleted even when group snapshots were disabled,
+	// the group snapshot is deleted together with the last member snapshot
+	store.groupSnapshots = false
+	assert.NoError(t, store.DeleteSnapshot("s0"))
+	assert.False(t, cinder.snapshotDeleted)
+	assert.NoError(t, store.DeleteSnapshot("s2"))
+	assert.True(t, cinder.snapshotDeleted)
+	assert.True(t, cinder.groupDeleted)
+}
+
+func TestDeleteSnapshotWithoutGroupMicroversion(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	snapshotID := "3fbbcccf-d058-4502-8844-6feeffdf4cb5"
+	deleted := false
+
+	fakeServer.Mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"versions": [{"id": "v3.0", "status": "CURRENT", "version": "3.10", "min_version": "3.0"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/snapshots/"+snapshotID, func(w http.ResponseWriter, r *http.Request) {
+		// the group microversion is not supported, the snapshot is deleted
+		// as a plain snapshot
+		assert.Empty(t, r.Header.Get("OpenStack-API-Version"))
+		switch r.Method {
+		case "GET":
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"snapshot": {"id": "%s", "status": "available"}}`, snapshotID)
+		case "DELETE":
+			deleted = true
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+
+	store := BlockStore{
+		client: fakeClient.ServiceClient(fakeServer),
+		log:    logrus.New(),
+		config: map[string]string{"method": "snapshot"},
+	}
+
+	ok, err := store.supportsMicroversion(volumeGroupMicroversion)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	store.groupsSupported = ok
+	assert.NoError(t, store.DeleteSnapshot("snapshot:"+snapshotID))
+	assert.True(t, deleted)
+}
+
+func TestReclaimGroupSnapshots(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	volumeIDs := []string{"7d3b2c5e-0d55-4b9a-9f6d-3f0d7d7e9a01", "7d3b2c5e-0d55-4b9a-9f6d-3f0d7d7e9a02"}
+	cinder := &fakeGroupCinder{}
+	cinder.handle(t, fakeServer, volumeIDs)
+
+	data, dataPV := newGroupPVC("data", volumeIDs[0], "db")
+	wal, walPV := newGroupPVC("wal", volumeIDs[1], "db")
+
+	store := BlockStore{
+		client:           fakeClient.ServiceClient(fakeServer),
+		log:              logrus.New(),
+		config:           map[string]string{"method": "snapshot"},
+		groupSnapshots:   true,
+		groupSnapshotKey: defaultGroupSnapshotKey,
+		groupType:        "consistent",
+		groupCache:       &groupSnapshotCache{},
+		groupsSupported:  true,
+		kubeClient:       fake.NewClientset(data, dataPV, wal, walPV),
+		volumeTimeout:    3,
+		snapshotTimeout:  3,
+	}
+	g, _, err := store.getVolumeGroup(dataPV)
+	assert.NoError(t, err)
+	store.groupCache.setVolumeGroup(volumeIDs[0], g)
+
+	// the plugin exits before the backup takes the second member snapshot
+	snapshotID, ok, err := store.createGroupSnapshotMember(volumeIDs[0], "", map[string]string{"velero.io/backup": "daily"})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	for id, s := range cinder.snapshots {
+		metadata := s["metadata"].(map[string]string)
+		if id == snapshotID {
+			assert.Equal(t, groupSnapshotMemberTaken, metadata[groupSnapshotMemberKey])
+		} else {
+			assert.Equal(t, groupSnapshotMemberCreated, metadata[groupSnapshotMemberKey])
+		}
+	}
+
+	// the next plugin process finds the unclaimed member by the metadata
+	store.groupCache = &groupSnapshotCache{}
+	logWithFields := store.log.WithFields(logrus.Fields{})
+	assert.NoError(t, store.reclaimGroupSnapshots(logWithFields, groupSnapshotEntryTTL))
+	for id, s := range cinder.snapshots {
+		if id != snapshotID {
+			assert.Equal(t, groupSnapshotMemberCreated, s["metadata"].(map[string]string)[groupSnapshotMemberKey], "recent members must be kept")
+		}
+	}
+
+	assert.NoError(t, store.reclaimGroupSnapshots(logWithFields, 0))
+	for id, s := range cinder.snapshots {
+		if id != snapshotID {
+			assert.Equal(t, groupSnapshotMemberFreed, s["metadata"].(map[string]string)[groupSnapshotMemberKey])
+		}
+	}
+	assert.False(t, cinder.snapshotDeleted, "the group snapshot is used by the backup")
+
+	// the group snapshot is deleted with the member snapshot of the backup
+	assert.NoError(t, store.DeleteSnapshot(snapshotID))
+	assert.True(t, cinder.snapshotDeleted)
+	assert.True(t, cinder.groupDeleted)
+}
@@ -0,0 +1,93 @@
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/v2/openstack/image/v2/imageimport"
+	"github.com/gophercloud/gophercloud/v2/openstack/image/v2/images"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// copyImageMethod is a Glance import method, which copies existing image
+	// data into additional stores
+	copyImageMethod imageimport.ImportMethod = "copy-image"
+	// image properties with the Glance stores of the image
+	imageStoresProperty          = "stores"
+	imageImportingStoresProperty = "os_glance_importing_to_stores"
+	imageFailedStoresProperty    = "os_glance_failed_import"
+)
+
+// copyImageOpts requests a copy of the image into the additional stores
+type copyImageOpts struct {
+	Stores []string
+}
+
+// ToImportCreateMap formats a copyImageOpts into a request body.
+func (opts copyImageOpts) ToImportCreateMap() (map[string]any, error) {
+	return map[string]any{
+		"method": map[string]any{
+			"name": copyImageMethod,
+		},
+		"stores":                  opts.Stores,
+		"all_stores_must_succeed": true,
+	}, nil
+}
+
+// copyImageToStores copies the image into the "imageStores" Glance stores
+// and waits until all stores contain the image
+func (b *BlockStore) copyImageToStores(logWithFields *logrus.Entry, imageID string) error {
+	image, err := images.Get(context.TODO(), b.imgClient, imageID).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to get image %v: %w", imageID, utils.WrapError(err))
+	}
+
+	var missing []string
+	for _, store := range b.imageStores {
+		if !utils.SliceContains(imageStoreList(image, imageStoresProperty), store) {
+			missing = append(missing, store)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	logWithFields.Infof("Copying image into %q stores", missing)
+	err = imageimport.Create(context.TODO(), b.imgClient, imageID, copyImageOpts{Stores: missing}).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("failed to copy image %v into %q stores: %w", imageID, missing, utils.WrapError(err))
+	}
+
+	err = utils.WaitForStatus([]string{"copied"}, b.imageTimeout, func() (string, error) {
+		image, err := images.Get(context.TODO(), b.imgClient, imageID).Extract()
+		if err != nil {
+			return "", err
+		}
+		if failed := imageStoreList(image, imageFailedStoresProperty); len(failed) > 0 {
+			return "", fmt.Errorf("failed to copy image into %q stores", failed)
+		}
+		stores := imageStoreList(image, imageStoresProperty)
+		for _, store := range b.imageStores {
+			if !utils.SliceContains(stores, store) {
+				return "copying", nil
+			}
+		}
+		return "copied", nil
+	})
+	if err != nil {
+		return fmt.Errorf("image %v wasn't copied into %q stores within the time limit: %w", imageID, missing, utils.WrapError(err))
+	}
+
+	logWithFields.Infof("Image was copied into %q stores", b.imageStores)
+	return nil
+}
+
+// imageStoreList returns a comma separated list of stores from the image
+// property
+func imageStoreList(image *images.Image, property string) []string {
+	v, _ := image.Properties[property].(string)
+	return utils.ParseList(strings.TrimSpace(v))
+}
@@ -0,0 +1,48 @@
+package cinder
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyImageToStores(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	imageID := "1bea47ed-f6a9-463b-b423-14b9cca9ad27"
+	stores := "ceph"
+
+	fakeServer.Mux.HandleFunc("/images/"+imageID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": "%s", "status": "active", "stores": "%s"}`, imageID, stores)
+	})
+	fakeServer.Mux.HandleFunc("/images/"+imageID+"/import", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		th.TestJSONRequest(t, r, `{"method": {"name": "copy-image"}, "stores": ["offsite"], "all_stores_must_succeed": true}`)
+		stores = "ceph,offsite"
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	store := BlockStore{
+		imgClient:    fakeClient.ServiceClient(fakeServer),
+		log:          logrus.New(),
+		imageStores:  []string{"ceph", "offsite"},
+		imageTimeout: 3,
+	}
+	logWithFields := store.log.WithFields(logrus.Fields{"imageID": imageID})
+
+	err := store.copyImageToStores(logWithFields, imageID)
+	assert.NoError(t, err)
+	assert.Equal(t, "ceph,offsite", stores)
+
+	// the image is already in all stores
+	err = store.copyImageToStores(logWithFields, imageID)
+	assert.NoError(t, err)
+}
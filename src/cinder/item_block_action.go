@@ -0,0 +1,241 @@
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/sirupsen/logrus"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/kuberesource"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	veleroitemblockaction "github.com/vmware-tanzu/velero/pkg/plugin/velero/itemblockaction/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// cinderProviders are the names the Cinder BlockStore is registered with
+var cinderProviders = map[string]struct{}{
+	"community.openstack.org/openstack":        {},
+	"community.openstack.org/openstack-cinder": {},
+}
+
+var volumeSnapshotLocations = velerov1.SchemeGroupVersion.WithResource("volumesnapshotlocations")
+
+// ItemBlockAction is a plugin, which groups PVCs backed by Cinder volumes
+// into a single Velero item block, so their volumes are snapshotted back to
+// back. PVCs are grouped by pods mounting them and by the groupSnapshotKey
+// label of the Cinder volume snapshot locations.
+type ItemBlockAction struct {
+	log           logrus.FieldLogger
+	kubeClient    kubernetes.Interface
+	dynamicClient dynamic.Interface
+}
+
+// NewItemBlockAction instantiates a Cinder PVC ItemBlockAction.
+func NewItemBlockAction(log logrus.FieldLogger) (*ItemBlockAction, error) {
+	kubeClient, err := utils.NewKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := utils.NewDynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	return &ItemBlockAction{log: log, kubeClient: kubeClient, dynamicClient: dynamicClient}, nil
+}
+
+var _ veleroitemblockaction.ItemBlockAction = (*ItemBlockAction)(nil)
+
+// Name returns the name of the ItemBlockAction.
+func (a *ItemBlockAction) Name() string {
+	return "CinderPVCItemBlockAction"
+}
+
+// AppliesTo returns the resources the ItemBlockAction is invoked for.
+func (a *ItemBlockAction) AppliesTo() (velero.ResourceSelector, error) {
+	return velero.ResourceSelector{
+		IncludedResources: []string{"persistentvolumeclaims"},
+	}, nil
+}
+
+// GetRelatedItems returns pods mounting the PVC, PVCs of Cinder volumes
+// mounted by the same pods and PVCs of Cinder volumes with the same
+// consistency group label.
+func (a *ItemBlockAction) GetRelatedItems(item runtime.Unstructured, backup *velerov1.Backup) ([]velero.ResourceIdentifier, error) {
+	pvc := new(v1.PersistentVolumeClaim)
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.UnstructuredContent(), pvc); err != nil {
+		return nil, fmt.Errorf("failed to convert from unstructured PVC: %w", err)
+	}
+
+	logWithFields := a.log.WithFields(logrus.Fields{
+		"namespace": pvc.Namespace,
+		"pvc":       pvc.Name,
+	})
+	logWithFields.Info("ItemBlockAction.GetRelatedItems called")
+
+	if pvc.Status.Phase != v1.ClaimBound || pvc.Spec.VolumeName == "" {
+		return nil, nil
+	}
+	ok, err := a.isCinderPVC(pvc)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	pods := make(map[string]struct{})
+	pvcs := make(map[string]struct{})
+
+	// group PVCs mounted by the same running pods
+	podList, err := a.kubeClient.CoreV1().Pods(pvc.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods in %s namespace: %w", pvc.Namespace, err)
+	}
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != v1.PodRunning || !mountsPVC(&pod, pvc.Name) {
+			continue
+		}
+		pods[pod.Name] = struct{}{}
+		for _, volume := range pod.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName == pvc.Name {
+				continue
+			}
+			claim, err := a.kubeClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(context.TODO(), volume.PersistentVolumeClaim.ClaimName, metav1.GetOptions{})
+			if err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return nil, fmt.Errorf("failed to get %s/%s PVC: %w", pvc.Namespace, volume.PersistentVolumeClaim.ClaimName, err)
+			}
+			ok, err := a.isCinderPVC(claim)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				pvcs[claim.Name] = struct{}{}
+			}
+		}
+	}
+
+	// group PVCs with the same consistency group label
+	keys, err := a.groupSnapshotKeys(backup)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		group := pvc.Labels[key]
+		if group == "" {
+			continue
+		}
+		selector := labels.SelectorFromSet(labels.Set{key: group}).String()
+		claims, err := a.kubeClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list PVCs in %s namespace with %q selector: %w", pvc.Namespace, selector, err)
+		}
+		for _, claim := range claims.Items {
+			if claim.Name == pvc.Name || claim.Status.Phase != v1.ClaimBound {
+				continue
+			}
+			ok, err := a.isCinderPVC(&claim)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				pvcs[claim.Name] = struct{}{}
+			}
+		}
+	}
+
+	var items []velero.ResourceIdentifier
+	for _, name := range sortedKeys(pods) {
+		items = append(items, velero.ResourceIdentifier{
+			GroupResource: kuberesource.Pods,
+			Namespace:     pvc.Namespace,
+			Name:          name,
+		})
+	}
+	for _, name := range sortedKeys(pvcs) {
+		items = append(items, velero.ResourceIdentifier{
+			GroupResource: kuberesource.PersistentVolumeClaims,
+			Namespace:     pvc.Namespace,
+			Name:          name,
+		})
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"relatedItems": items,
+	}).Info("Related items were found")
+	return items, nil
+}
+
+// groupSnapshotKeys returns the groupSnapshotKey labels of the Cinder volume
+// snapshot locations used by the backup. All Cinder locations are used, when
+// the backup doesn't list its volume snapshot locations.
+func (a *ItemBlockAction) groupSnapshotKeys(backup *velerov1.Backup) ([]string, error) {
+	list, err := a.dynamicClient.Resource(volumeSnapshotLocations).Namespace(backup.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume snapshot locations in %s namespace: %w", backup.Namespace, err)
+	}
+
+	selected := make(map[string]struct{}, len(backup.Spec.VolumeSnapshotLocations))
+	for _, name := range backup.Spec.VolumeSnapshotLocations {
+		selected[name] = struct{}{}
+	}
+
+	keys := make(map[string]struct{})
+	for _, item := range list.Items {
+		location := new(velerov1.VolumeSnapshotLocation)
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.UnstructuredContent(), location); err != nil {
+			return nil, fmt.Errorf("failed to convert from unstructured volume snapshot location: %w", err)
+		}
+		if _, ok := cinderProviders[location.Spec.Provider]; !ok {
+			continue
+		}
+		if _, ok := selected[location.Name]; len(selected) > 0 && !ok {
+			continue
+		}
+		keys[utils.GetConf(location.Spec.Config, "groupSnapshotKey", defaultGroupSnapshotKey)] = struct{}{}
+	}
+	if len(keys) == 0 {
+		keys[defaultGroupSnapshotKey] = struct{}{}
+	}
+	return sortedKeys(keys), nil
+}
+
+// isCinderPVC returns true, when the PVC is bound to a Cinder volume
+func (a *ItemBlockAction) isCinderPVC(pvc *v1.PersistentVolumeClaim) (bool, error) {
+	if pvc.Spec.VolumeName == "" {
+		return false, nil
+	}
+	pv, err := a.kubeClient.CoreV1().PersistentVolumes().Get(context.TODO(), pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get %s PV: %w", pvc.Spec.VolumeName, err)
+	}
+	return getPVVolumeID(pv) != "", nil
+}
+
+func mountsPVC(pod *v1.Pod, claimName string) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == claimName {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,134 @@
+package cinder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/kuberesource"
+	"github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newPod(name string, claims ...string) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "app"},
+		Status:     v1.PodStatus{Phase: v1.PodRunning},
+	}
+	for _, claim := range claims {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+			Name: claim,
+			VolumeSource: v1.VolumeSource{
+				PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+			},
+		})
+	}
+	return pod
+}
+
+func TestItemBlockActionGetRelatedItems(t *testing.T) {
+	data, dataPV := newGroupPVC("data", "7d3b2c5e-0d55-4b9a-9f6d-3f0d7d7e9a01", "db")
+	wal, walPV := newGroupPVC("wal", "7d3b2c5e-0d55-4b9a-9f6d-3f0d7d7e9a02", "")
+	logs, logsPV := newGroupPVC("logs", "7d3b2c5e-0d55-4b9a-9f6d-3f0d7d7e9a03", "db")
+	nfs, nfsPV := newGroupPVC("nfs", "nfs-share", "")
+	nfsPV.Spec.CSI.Driver = "nfs.csi.k8s.io"
+	other, otherPV := newGroupPVC("other", "7d3b2c5e-0d55-4b9a-9f6d-3f0d7d7e9a04", "")
+	// PVCs of other drivers with the same label are ignored
+	share, sharePV := newGroupPVC("share", "nfs-share-2", "db")
+	sharePV.Spec.CSI.Driver = "nfs.csi.k8s.io"
+	// the label configured in the Cinder volume snapshot location is used
+	cache, cachePV := newGroupPVC("cache", "7d3b2c5e-0d55-4b9a-9f6d-3f0d7d7e9a05", "")
+	cache.Labels = map[string]string{"example.com/group": "db"}
+	data.Labels["example.com/group"] = "db"
+	for _, pvc := range []*v1.PersistentVolumeClaim{data, wal, logs, nfs, other, share, cache} {
+		pvc.Status.Phase = v1.ClaimBound
+	}
+
+	scheme := runtime.NewScheme()
+	assert.NoError(t, velerov1.AddToScheme(scheme))
+	action := &ItemBlockAction{
+		log: logrus.New(),
+		kubeClient: fake.NewClientset(
+			data, dataPV, wal, walPV, logs, logsPV, nfs, nfsPV, other, otherPV, share, sharePV, cache, cachePV,
+			newPod("db-0", "data", "wal", "nfs"),
+			newPod("other-0", "other"),
+		),
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(scheme,
+			&velerov1.VolumeSnapshotLocation{
+				ObjectMeta: metav1.ObjectMeta{Name: "cinder", Namespace: "velero"},
+				Spec: velerov1.VolumeSnapshotLocationSpec{
+					Provider: "community.openstack.org/openstack-cinder",
+					Config:   map[string]string{"groupSnapshotKey": "example.com/group"},
+				},
+			},
+			&velerov1.VolumeSnapshotLocation{
+				ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "velero"},
+				Spec:       velerov1.VolumeSnapshotLocationSpec{Provider: "community.openstack.org/openstack"},
+			},
+			&velerov1.VolumeSnapshotLocation{
+				ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "velero"},
+				Spec: velerov1.VolumeSnapshotLocationSpec{
+					Provider: "aws",
+					Config:   map[string]string{"groupSnapshotKey": "example.com/other"},
+				},
+			},
+		),
+	}
+
+	tests := []struct {
+		pvc       *v1.PersistentVolumeClaim
+		locations []string
+		expected  []velero.ResourceIdentifier
+	}{
+		{
+			pvc: data,
+			expected: []velero.ResourceIdentifier{
+				{GroupResource: kuberesource.Pods, Namespace: "app", Name: "db-0"},
+				{GroupResource: kuberesource.PersistentVolumeClaims, Namespace: "app", Name: "cache"},
+				{GroupResource: kuberesource.PersistentVolumeClaims, Namespace: "app", Name: "logs"},
+				{GroupResource: kuberesource.PersistentVolumeClaims, Namespace: "app", Name: "wal"},
+			},
+		},
+		{
+			// only the locations of the backup are used
+			pvc:       data,
+			locations: []string{"cinder"},
+			expected: []velero.ResourceIdentifier{
+				{GroupResource: kuberesource.Pods, Namespace: "app", Name: "db-0"},
+				{GroupResource: kuberesource.PersistentVolumeClaims, Namespace: "app", Name: "cache"},
+				{GroupResource: kuberesource.PersistentVolumeClaims, Namespace: "app", Name: "wal"},
+			},
+		},
+		{
+			pvc: other,
+			expected: []velero.ResourceIdentifier{
+				{GroupResource: kuberesource.Pods, Namespace: "app", Name: "other-0"},
+			},
+		},
+		{
+			// PVCs of other drivers are ignored
+			pvc: nfs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pvc.Name+strings.Join(tt.locations, ","), func(t *testing.T) {
+			obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tt.pvc)
+			assert.NoError(t, err)
+
+			items, err := action.GetRelatedItems(&unstructured.Unstructured{Object: obj}, &velerov1.Backup{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "velero"},
+				Spec:       velerov1.BackupSpec{VolumeSnapshotLocations: tt.locations},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, items)
+		})
+	}
+}
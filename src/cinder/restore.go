@@ -0,0 +1,285 @@
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/availabilityzones"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/backups"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumetypes"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// csiClusterKey is a volume metadata key with the ID of the cluster,
+	// which created the volume using the Cinder CSI driver
+	csiClusterKey = "cinder.csi.openstack.org/cluster"
+)
+
+// internalMetadataKeys are plugin metadata keys of snapshots and backups,
+// which are never copied to restored volumes
+var internalMetadataKeys = []string{
+	backupParentKey,
+	backupPendingDeletionKey,
+	tierBackupKey,
+	tierSnapshotKey,
+	tierAfterKey,
+}
+
+// metadataPolicy rewrites the origin volume metadata copied to restored
+// volumes
+type metadataPolicy struct {
+	// drop is a list of dropped keys, keys ending with "*" drop all keys
+	// with the prefix
+	drop []string
+	// rewrite maps key prefixes to new key prefixes
+	rewrite map[string]string
+	// set is a map of static keys set on restored volumes
+	set map[string]string
+}
+
+// apply returns a copy of the metadata rewritten by the policy
+func (p metadataPolicy) apply(metadata map[string]string) map[string]string {
+	res := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		if utils.SliceContains(internalMetadataKeys, k) || p.dropped(k) {
+			continue
+		}
+		res[p.rewritten(k)] = v
+	}
+	for k, v := range p.set {
+		res[k] = v
+	}
+	return res
+}
+
+// rewritten returns the key with the longest matching rewrite prefix
+// replaced
+func (p metadataPolicy) rewritten(key string) string {
+	var oldPrefix string
+	for prefix := range p.rewrite {
+		if strings.HasPrefix(key, prefix) && len(prefix) > len(oldPrefix) {
+			oldPrefix = prefix
+		}
+	}
+	if oldPrefix == "" {
+		return key
+	}
+	return p.rewrite[oldPrefix] + strings.TrimPrefix(key, oldPrefix)
+}
+
+func (p metadataPolicy) dropped(key string) bool {
+	for _, k := range p.drop {
+		if prefix, ok := strings.CutSuffix(k, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMetadataPolicy parses the metadata policy of restored volumes
+func parseMetadataPolicy(config map[string]string) (metadataPolicy, error) {
+	var err error
+	p := metadataPolicy{
+		drop: utils.ParseList(utils.GetConf(config, "restoreMetadataDrop", "")),
+	}
+	p.rewrite, err = utils.ParseMap(utils.GetConf(config, "restoreMetadataRewrite", ""))
+	if err != nil {
+		return p, fmt.Errorf("cannot parse restoreMetadataRewrite config variable: %w", err)
+	}
+	p.set, err = utils.ParseMap(utils.GetConf(config, "restoreMetadata", ""))
+	if err != nil {
+		return p, fmt.Errorf("cannot parse restoreMetadata config variable: %w", err)
+	}
+	if cluster := utils.GetConf(config, "restoreCSICluster", ""); cluster != "" {
+		p.set[csiClusterKey] = cluster
+	}
+	return p, nil
+}
+
+// restoreVolumeType returns the volume type of the restored volume. Types
+// are translated using "volumeTypeMap", unknown types are replaced by
+// "defaultVolumeType".
+func (b *BlockStore) restoreVolumeType(logWithFields *logrus.Entry, volumeType string) (string, error) {
+	if newType, ok := b.volumeTypeMap[volumeType]; ok {
+		logWithFields.Infof("Mapping %q volume type to %q", volumeType, newType)
+		return newType, nil
+	}
+	if b.defaultVolumeType == "" {
+		return volumeType, nil
+	}
+
+	pages, err := volumetypes.List(b.client, volumetypes.ListOpts{}).AllPages(context.TODO())
+	if err != nil {
+		return "", fmt.Errorf("failed to list volume types: %w", utils.WrapError(err))
+	}
+	types, err := volumetypes.ExtractVolumeTypes(pages)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract volume types: %w", err)
+	}
+	for _, t := range types {
+		if volumeType != "" && (t.Name == volumeType || t.ID == volumeType) {
+			return volumeType, nil
+		}
+	}
+
+	logWithFields.Infof("Volume type %q doesn't exist, using the %q default volume type", volumeType, b.defaultVolumeType)
+	return b.defaultVolumeType, nil
+}
+
+// restoreSize returns the size of the restored volume in GiB, which is at
+// least "restoreMinSize" and the original size multiplied by
+// "restoreSizeMultiplier"
+func (b *BlockStore) restoreSize(size int) int {
+	newSize := size
+	if b.restoreMultiplier > 1 {
+		newSize = int(math.Ceil(float64(size) * b.restoreMultiplier))
+	}
+	return max(newSize, size, b.restoreMinSize)
+}
+
+// resizeRestoredVolume extends the restored volume after it's created, so the
+// resizing works regardless of the backend support of larger volumes created
+// from snapshots, backups or images
+func (b *BlockStore) resizeRestoredVolume(logWithFields *logrus.Entry, volumeID string) error {
+	if b.restoreMinSize == 0 && b.restoreMultiplier <= 1 {
+		return nil
+	}
+
+	volume, err := volumes.Get(context.TODO(), b.client, volumeID).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, utils.WrapError(err))
+	}
+
+	newSize := b.restoreSize(volume.Size)
+	if newSize <= volume.Size {
+		return nil
+	}
+
+	logWithFields.Infof("Extending restored volume from %d to %d GiB", volume.Size, newSize)
+	err = volumes.ExtendSize(context.TODO(), b.client, volumeID, volumes.ExtendSizeOpts{NewSize: newSize}).ExtractErr()
+	if err != nil {
+		return fmt.Errorf("failed to extend volume %v to %d GiB: %w", volumeID, newSize, utils.WrapError(err))
+	}
+
+	_, err = b.waitForVolumeStatus(volumeID, volumeStatuses, b.volumeTimeout)
+	if err != nil {
+		return fmt.Errorf("volume %v didn't get into 'available' state within the time limit: %w", volumeID, utils.WrapError(err))
+	}
+	return nil
+}
+
+// restoreAZ returns the availability zone of the restored volume. The
+// requested zone is translated using "availabilityZoneMap" and validated
+// against the Cinder availability zones, when "fallbackAZ" is set. The fallback
+// applies, when the zone is not available.
+func (b *BlockStore) restoreAZ(logWithFields *logrus.Entry, snapshotID, volumeAZ string) (string, error) {
+	if volumeAZ == "" {
+		return "", nil
+	}
+
+	// without a fallback policy the zone is passed to Cinder as is, e.g. Cinder
+	// may fall back to its default zone by itself
+	if b.fallbackAZ == "" {
+		az := volumeAZ
+		if v, ok := b.azMap[az]; ok {
+			az = v
+			logWithFields.Infof("Restoring volume into %q availability zone instead of %q", az, volumeAZ)
+		}
+		return az, nil
+	}
+
+	pages, err := availabilityzones.List(b.client).AllPages(context.TODO())
+	if err != nil {
+		return "", fmt.Errorf("failed to list availability zones: %w", utils.WrapError(err))
+	}
+	allZones, err := availabilityzones.ExtractAvailabilityZones(pages)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract availability zones: %w", err)
+	}
+	var zones []string
+	for _, zone := range allZones {
+		if zone.ZoneState.Available {
+			zones = append(zones, zone.ZoneName)
+		}
+	}
+
+	var sourceAZ string
+	if b.fallbackAZ == "same" {
+		sourceAZ, err = b.snapshotAZ(snapshotID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Warning("failed to get availability zone of the snapshot source")
+		}
+	}
+
+	az, err := utils.ResolveAZ(volumeAZ, b.azMap, zones, b.fallbackAZ, sourceAZ)
+	if err != nil {
+		return "", err
+	}
+	if az != volumeAZ {
+		logWithFields.Infof("Restoring volume into %q availability zone instead of %q", az, volumeAZ)
+	}
+	return az, nil
+}
+
+// snapshotAZ returns the availability zone of the snapshot source volume
+func (b *BlockStore) snapshotAZ(snapshotID string) (string, error) {
+	volumeID := snapshotID
+	switch b.config["method"] {
+	case "backup", "snapshot-backup":
+		backup, err := backups.Get(context.TODO(), b.client, snapshotID).Extract()
+		if err != nil {
+			return "", fmt.Errorf("failed to get backup %v from cinder: %w", snapshotID, utils.WrapError(err))
+		}
+		if backup.AvailabilityZone == nil {
+			return "", nil
+		}
+		return *backup.AvailabilityZone, nil
+	case "image":
+		// images are not bound to an availability zone
+		return "", nil
+	case "snapshot":
+		snapshot, err := snapshots.Get(context.TODO(), b.client, snapshotID).Extract()
+		if err != nil {
+			return "", fmt.Errorf("failed to get snapshot %v from cinder: %w", snapshotID, utils.WrapError(err))
+		}
+		volumeID = snapshot.VolumeID
+	}
+
+	volume, err := volumes.Get(context.TODO(), b.client, volumeID).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, utils.WrapError(err))
+	}
+	return volume.AvailabilityZone, nil
+}
+
+// recordVolumeAZ remembers the availability zone of the restored volume,
+// when it differs from the requested one, so SetVolumeID reflects it in the
+// PV topology
+func (b *BlockStore) recordVolumeAZ(logWithFields *logrus.Entry, volumeID, volumeAZ, az string) error {
+	if az == volumeAZ {
+		return nil
+	}
+
+	if az == "" {
+		// the scheduler has chosen the availability zone
+		volume, err := volumes.Get(context.TODO(), b.client, volumeID).Extract()
+		if err != nil {
+			return fmt.Errorf("failed to get volume %v from cinder: %w", volumeID, utils.WrapError(err))
+		}
+		az = volume.AvailabilityZone
+	}
+
+	logWithFields.Infof("Volume was restored into %q availability zone", az)
+	b.azCache.SetVolumeAZ(volumeID, az)
+	return nil
+}
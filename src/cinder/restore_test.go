@@ -0,0 +1,321 @@
+package cinder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/image/v2/images"
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestRestoreVolumeType(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	fakeServer.Mux.HandleFunc("/types", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"volume_types": [{"id": "6685584b-1eac-4da6-b5c3-555430cf68ff", "name": "ssd"}, {"id": "8eb69a46-df97-4e41-9586-9a40a7533803", "name": "hdd"}]}`)
+	})
+
+	store := BlockStore{
+		client:            fakeClient.ServiceClient(fakeServer),
+		log:               logrus.New(),
+		volumeTypeMap:     map[string]string{"fast": "ssd"},
+		defaultVolumeType: "hdd",
+	}
+	logWithFields := store.log.WithFields(logrus.Fields{})
+
+	tests := map[string]string{
+		"fast":                                 "ssd",
+		"ssd":                                  "ssd",
+		"8eb69a46-df97-4e41-9586-9a40a7533803": "8eb69a46-df97-4e41-9586-9a40a7533803",
+		"missing":                              "hdd",
+		"":                                     "hdd",
+	}
+	for volumeType, expected := range tests {
+		actual, err := store.restoreVolumeType(logWithFields, volumeType)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual, volumeType)
+	}
+
+	store.defaultVolumeType = ""
+	actual, err := store.restoreVolumeType(logWithFields, "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, "missing", actual)
+}
+
+func TestRestoreSize(t *testing.T) {
+	tests := []struct {
+		minSize    int
+		multiplier float64
+		size       int
+		expected   int
+	}{
+		{0, 1, 10, 10},
+		{20, 1, 10, 20},
+		{5, 1, 10, 10},
+		{0, 1.5, 10, 15},
+		{0, 1.25, 3, 4},
+		{20, 1.5, 10, 20},
+		{12, 1.5, 10, 15},
+	}
+	for _, test := range tests {
+		store := BlockStore{restoreMinSize: test.minSize, restoreMultiplier: test.multiplier}
+		assert.Equal(t, test.expected, store.restoreSize(test.size), "%+v", test)
+	}
+}
+
+func TestResizeRestoredVolume(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	volumeID := "b0b9a8b3-7a4f-4ab2-8b41-5b2c0c1e8d1f"
+	size := 10
+
+	fakeServer.Mux.HandleFunc("/volumes/"+volumeID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"volume": {"id": "%s", "status": "available", "size": %d}}`, volumeID, size)
+	})
+	fakeServer.Mux.HandleFunc("/volumes/"+volumeID+"/action", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		th.TestJSONRequest(t, r, `{"os-extend": {"new_size": 15}}`)
+		size = 15
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	store := BlockStore{
+		client:            fakeClient.ServiceClient(fakeServer),
+		log:               logrus.New(),
+		restoreMultiplier: 1.5,
+		volumeTimeout:     3,
+	}
+	logWithFields := store.log.WithFields(logrus.Fields{"volumeID": volumeID})
+
+	err := store.resizeRestoredVolume(logWithFields, volumeID)
+	assert.NoError(t, err)
+	assert.Equal(t, 15, size)
+}
+
+func TestRestoreAZ(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	volumeID := "b0b9a8b3-7a4f-4ab2-8b41-5b2c0c1e8d1f"
+
+	fakeServer.Mux.HandleFunc("/os-availability-zone", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"availabilityZoneInfo": [{"zoneName": "az1", "zoneState": {"available": true}}, {"zoneName": "az2", "zoneState": {"available": true}}, {"zoneName": "az3", "zoneState": {"available": false}}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/snapshots/snap1", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"snapshot": {"id": "snap1", "volume_id": "src", "status": "available"}}`)
+	})
+	fakeServer.Mux.HandleFunc("/volumes/src", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"volume": {"id": "src", "status": "available", "availability_zone": "az2"}}`)
+	})
+
+	store := BlockStore{
+		client:     fakeClient.ServiceClient(fakeServer),
+		log:        logrus.New(),
+		config:     map[string]string{"method": "snapshot"},
+		azMap:      map[string]string{"old-az1": "az1"},
+		fallbackAZ: "same",
+		azCache:    &utils.AZCache{},
+	}
+	logWithFields := store.log.WithFields(logrus.Fields{})
+
+	az, err := store.restoreAZ(logWithFields, "snap1", "old-az1")
+	assert.NoError(t, err)
+	assert.Equal(t, "az1", az)
+
+	az, err = store.restoreAZ(logWithFields, "snap1", "az3")
+	assert.NoError(t, err)
+	assert.Equal(t, "az2", az)
+
+	store.fallbackAZ = "fail"
+	_, err = store.restoreAZ(logWithFields, "snap1", "az3")
+	assert.Error(t, err)
+
+	// without a fallback the zone is only mapped and passed as is
+	store.fallbackAZ = ""
+	az, err = store.restoreAZ(logWithFields, "snap1", "az3")
+	assert.NoError(t, err)
+	assert.Equal(t, "az3", az)
+	az, err = store.restoreAZ(logWithFields, "snap1", "old-az1")
+	assert.NoError(t, err)
+	assert.Equal(t, "az1", az)
+
+	err = store.recordVolumeAZ(logWithFields, volumeID, "az3", "az2")
+	assert.NoError(t, err)
+
+	pv := &v1.PersistentVolume{
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{Driver: "cinder.csi.openstack.org"},
+			},
+			NodeAffinity: &v1.VolumeNodeAffinity{
+				Required: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{
+						MatchExpressions: []v1.NodeSelectorRequirement{
+							{Key: csiTopologyKey, Operator: v1.NodeSelectorOpIn, Values: []string{"az3"}},
+						},
+					}},
+				},
+			},
+		},
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pv)
+	assert.NoError(t, err)
+
+	res, err := store.SetVolumeID(&unstructured.Unstructured{Object: obj}, volumeID)
+	assert.NoError(t, err)
+	restoredPV := new(v1.PersistentVolume)
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(res.UnstructuredContent(), restoredPV)
+	assert.NoError(t, err)
+	assert.Equal(t, volumeID, restoredPV.Spec.CSI.VolumeHandle)
+	assert.Equal(t, []string{"az2"}, restoredPV.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions[0].Values)
+}
+
+func TestMetadataPolicy(t *testing.T) {
+	policy, err := parseMetadataPolicy(map[string]string{
+		"restoreMetadataDrop":    "csi.storage.k8s.io/pv/name,csi.storage.k8s.io/pvc/*",
+		"restoreMetadataRewrite": "source.example.com/=restored.example.com/,source.example.com/team/=restored.example.com/owner/",
+		"restoreMetadata":        "restored=true",
+		"restoreCSICluster":      "target-cluster",
+	})
+	assert.NoError(t, err)
+
+	metadata := map[string]string{
+		csiClusterKey:                      "source-cluster",
+		"csi.storage.k8s.io/pv/name":       "pvc-1",
+		"csi.storage.k8s.io/pvc/name":      "data",
+		"csi.storage.k8s.io/pvc/namespace": "default",
+		"source.example.com/owner":         "team",
+		"source.example.com/team/name":     "storage",
+		backupParentKey:                    "parent",
+		tierSnapshotKey:                    "snapshot",
+		"velero.io/backup":                 "backup1",
+	}
+	expected := map[string]string{
+		csiClusterKey:                "target-cluster",
+		"restored.example.com/owner": "team",
+		// the longest matching prefix wins
+		"restored.example.com/owner/name": "storage",
+		"velero.io/backup":                "backup1",
+		"restored":                        "true",
+	}
+	assert.Equal(t, expected, policy.apply(metadata))
+
+	// only internal keys are dropped by default
+	policy, err = parseMetadataPolicy(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "b"}, policy.apply(map[string]string{"a": "b", backupParentKey: "parent"}))
+}
+
+func TestImageMetadata(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	imageID := "1bea47ed-f6a9-463b-b423-14b9cca9ad27"
+	var created map[string]string
+
+	volume := &volumes.Volume{
+		Size:     10,
+		Metadata: map[string]string{"a": "b", csiClusterKey: "source-cluster"},
+	}
+	properties := map[string]any{}
+	var paths []string
+
+	fakeServer.Mux.HandleFunc("/images/"+imageID, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		image := map[string]any{"id": imageID, "status": "active"}
+		if r.Method == "PATCH" {
+			var ops []map[string]any
+			json.NewDecoder(r.Body).Decode(&ops)
+			for _, op := range ops {
+				path := op["path"].(string)
+				paths = append(paths, path)
+				// unescape the JSON pointer like Glance does
+				name := strings.NewReplacer("~1", "/", "~0", "~").Replace(strings.TrimPrefix(path, "/"))
+				if name != "min_disk" {
+					properties[name] = op["value"]
+				}
+			}
+		} else {
+			th.TestMethod(t, r, "GET")
+		}
+		for k, v := range properties {
+			image[k] = v
+		}
+		json.NewEncoder(w).Encode(image)
+	})
+
+	opts := expandVolumeProperties(logrus.New(), volume, map[string]string{"velero.io/backup": "backup1"})
+	_, err := images.Update(context.TODO(), fakeClient.ServiceClient(fakeServer), imageID, opts).Extract()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"/min_disk",
+		"/openstack.velero.io~1metadata~1a",
+		"/openstack.velero.io~1metadata~1cinder.csi.openstack.org~1cluster",
+		"/openstack.velero.io~1metadata~1velero.io~1backup",
+	}, paths)
+	assert.Equal(t, map[string]any{
+		imageMetadataPrefix + "a":                "b",
+		imageMetadataPrefix + csiClusterKey:      "source-cluster",
+		imageMetadataPrefix + "velero.io/backup": "backup1",
+	}, properties)
+
+	fakeServer.Mux.HandleFunc("/volumes", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		var req struct {
+			Volume struct {
+				Metadata map[string]string `json:"metadata"`
+			} `json:"volume"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		created = req.Volume.Metadata
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"volume": {"id": "restored", "status": "creating"}}`)
+	})
+	fakeServer.Mux.HandleFunc("/volumes/restored", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"volume": {"id": "restored", "status": "available"}}`)
+	})
+
+	policy, err := parseMetadataPolicy(map[string]string{"restoreCSICluster": "target-cluster"})
+	assert.NoError(t, err)
+	store := BlockStore{
+		client:         fakeClient.ServiceClient(fakeServer),
+		imgClient:      fakeClient.ServiceClient(fakeServer),
+		log:            logrus.New(),
+		config:         map[string]string{"method": "image"},
+		metadataPolicy: policy,
+		imageTimeout:   3,
+		volumeTimeout:  3,
+	}
+
+	volumeID, err := store.createVolumeFromImage(imageID, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "restored", volumeID)
+	assert.Equal(t, map[string]string{"a": "b", csiClusterKey: "target-cluster", "velero.io/backup": "backup1"}, created)
+}
@@ -0,0 +1,210 @@
+package cinder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/backups"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// tierBackupKey is a snapshot metadata key with the ID of the backup,
+	// which the snapshot is converted to
+	tierBackupKey = "openstack.velero.io/tier-backup"
+	// tierSnapshotKey is a backup metadata key with the ID of the snapshot,
+	// which was converted to the backup
+	tierSnapshotKey = "openstack.velero.io/tier-snapshot"
+	// tierAfterKey is a snapshot metadata key with the "tierAfter" seconds of
+	// the location, which created the snapshot
+	tierAfterKey = "openstack.velero.io/tier-after"
+	// veleroBackupKey is a metadata key set by Velero on the snapshots
+	veleroBackupKey = "velero.io/backup"
+	// tierTriggerInterval is the minimum time between the tiering passes
+	// triggered by created and deleted snapshots
+	tierTriggerInterval = 5 * time.Minute
+)
+
+// startTiering converts aging snapshots into backups in the background, when
+// "tierAfter" is set. The first pass runs right away, next passes run every
+// "tierInterval" or when triggered by created and deleted snapshots.
+func (b *BlockStore) startTiering() {
+	if b.tierAfter == 0 {
+		return
+	}
+
+	b.tierOnce.Do(func() {
+		logWithFields := b.log.WithFields(logrus.Fields{
+			"component":    "tiering",
+			"tierAfter":    b.tierAfter,
+			"tierInterval": b.tierInterval,
+		})
+		logWithFields.Info("Starting periodic snapshot tiering")
+
+		go func() {
+			ticker := time.NewTicker(time.Duration(b.tierInterval) * time.Second)
+			defer ticker.Stop()
+			for {
+				b.tierSnapshots(logWithFields, "")
+				last := time.Now()
+				for waiting := true; waiting; {
+					select {
+					case <-ticker.C:
+						waiting = false
+					case <-b.tierTrigger:
+						waiting = time.Since(last) < tierTriggerInterval
+					}
+				}
+			}
+		}()
+	})
+}
+
+// triggerTiering requests a tiering pass without waiting for it, the passes
+// are rate limited by tierTriggerInterval
+func (b *BlockStore) triggerTiering() {
+	if b.tierAfter == 0 {
+		return
+	}
+
+	select {
+	case b.tierTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// tierSnapshots converts snapshots created by locations with "tierAfter"
+// into backups, when they are older than the "tierAfter" recorded in their
+// metadata. Snapshots of all volumes are converted, when the volume ID is
+// empty. Errors are only logged.
+func (b *BlockStore) tierSnapshots(logWithFields *logrus.Entry, volumeID string) {
+	if b.tierAfter == 0 {
+		return
+	}
+
+	pages, err := snapshots.ListDetail(b.client, snapshots.ListOpts{VolumeID: volumeID}).AllPages(context.TODO())
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to list snapshots for tiering")
+		return
+	}
+	allSnapshots, err := snapshots.ExtractSnapshots(pages)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to extract snapshots for tiering")
+		return
+	}
+
+	for i := range allSnapshots {
+		snapshot := &allSnapshots[i]
+		// snapshots of other locations and manual snapshots are kept
+		tierAfter, err := strconv.Atoi(snapshot.Metadata[tierAfterKey])
+		if err != nil || tierAfter <= 0 || snapshot.Metadata[veleroBackupKey] == "" || snapshot.GroupSnapshotID != "" ||
+			!utils.SliceContains(snapshotStatuses, snapshot.Status) ||
+			time.Since(snapshot.CreatedAt) < time.Duration(tierAfter)*time.Second {
+			continue
+		}
+
+		err = b.tierSnapshot(logWithFields.WithField("snapshotID", snapshot.ID), snapshot)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to convert snapshot %s into backup", snapshot.ID)
+		}
+	}
+}
+
+// tierSnapshot converts the snapshot into a backup and deletes the snapshot
+func (b *BlockStore) tierSnapshot(logWithFields *logrus.Entry, snapshot *snapshots.Snapshot) error {
+	backupID := snapshot.Metadata[tierBackupKey]
+	if backupID == "" {
+		backupName := fmt.Sprintf("%s.tier.%s", snapshot.ID, strconv.FormatUint(utils.Rand.Uint64(), 10))
+		opts := &backups.CreateOpts{
+			Name:        backupName,
+			VolumeID:    snapshot.VolumeID,
+			SnapshotID:  snapshot.ID,
+			Description: "Velero snapshot backup",
+			Container:   backupName,
+			Metadata:    utils.Merge(snapshot.Metadata, map[string]string{tierSnapshotKey: snapshot.ID}),
+			Force:       true,
+		}
+		// Override container if one was passed by the user
+		if b.containerName != "" {
+			opts.Container = b.containerName
+		}
+
+		backup, err := backups.Create(context.TODO(), b.client, opts).Extract()
+		if err != nil {
+			return fmt.Errorf("failed to create backup from snapshot %v: %w", snapshot.ID, utils.WrapError(err))
+		}
+		backupID = backup.ID
+
+		// record the backup, so an interrupted conversion is finished later
+		metaOpts := snapshots.UpdateMetadataOpts{Metadata: make(map[string]any)}
+		for k, v := range utils.Merge(snapshot.Metadata, map[string]string{tierBackupKey: backupID}) {
+			metaOpts.Metadata[k] = v
+		}
+		_, err = snapshots.UpdateMetadata(context.TODO(), b.client, snapshot.ID, metaOpts).Extract()
+		if err != nil {
+			return fmt.Errorf("failed to record backup %v in snapshot %v metadata: %w", backupID, snapshot.ID, utils.WrapError(err))
+		}
+	}
+
+	_, err := b.waitForBackupStatus(backupID, backupStatuses, b.backupTimeout)
+	if err != nil {
+		return fmt.Errorf("backup %v didn't get into 'available' state within the time limit: %w", backupID, utils.WrapError(err))
+	}
+
+	if b.recordContainer != "" {
+		err = b.exportBackupRecord(logWithFields, backupID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.ensureDeleted {
+		err = b.ensureSnapshotDeleted(logWithFields, snapshot.ID, b.snapshotTimeout)
+	} else {
+		err = snapshots.Delete(context.TODO(), b.client, snapshot.ID).ExtractErr()
+	}
+	if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return fmt.Errorf("failed to delete snapshot %v converted into backup %v: %w", snapshot.ID, backupID, utils.WrapError(err))
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"backupID": backupID,
+	}).Info("Snapshot was converted into backup")
+	return nil
+}
+
+// resolveTieredSnapshot returns the ID of the backup, which the snapshot was
+// converted to. False is returned, when the snapshot still exists or it was
+// not converted.
+func (b *BlockStore) resolveTieredSnapshot(snapshotID string) (string, bool, error) {
+	_, err := snapshots.Get(context.TODO(), b.client, snapshotID).Extract()
+	if err == nil {
+		return "", false, nil
+	}
+	if !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return "", false, fmt.Errorf("failed to get snapshot %v from cinder: %w", snapshotID, utils.WrapError(err))
+	}
+
+	// backups are listed with the backup microversion
+	bk := b
+	if ok, _ := utils.CompareMicroversions("lte", volumeBackupMicroversion, b.client.Microversion); !ok {
+		bk, err = b.withMethod("backup")
+		if err != nil {
+			// tiering requires the backup microversion, the snapshot cannot
+			// be converted without it
+			b.log.WithField("snapshotID", snapshotID).Debugf("Skipping tiered snapshot lookup: %v", err)
+			return "", false, nil
+		}
+	}
+	backup, err := bk.findBackupByMetadata(tierSnapshotKey, snapshotID)
+	if err != nil || backup == nil {
+		return "", false, err
+	}
+	return backup.ID, true, nil
+}
@@ -0,0 +1,166 @@
+package cinder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTierSnapshots(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	volumeID := "521752a6-acf6-4b2d-bc7a-119f9148cd8c"
+	now := time.Now().UTC()
+	snapshots := map[string]map[string]any{
+		"old": {
+			"id": "old", "volume_id": volumeID, "status": "available",
+			"created_at": now.Add(-48 * time.Hour).Format("2006-01-02T15:04:05.000000"),
+			"metadata":   map[string]string{veleroBackupKey: "daily-1", tierAfterKey: "86400"},
+		},
+		"recent": {
+			"id": "recent", "volume_id": volumeID, "status": "available",
+			"created_at": now.Add(-time.Hour).Format("2006-01-02T15:04:05.000000"),
+			"metadata":   map[string]string{veleroBackupKey: "daily-2", tierAfterKey: "86400"},
+		},
+		"other-location": {
+			"id": "other-location", "volume_id": volumeID, "status": "available",
+			"created_at": now.Add(-48 * time.Hour).Format("2006-01-02T15:04:05.000000"),
+			"metadata":   map[string]string{veleroBackupKey: "daily-1"},
+		},
+		"manual": {
+			"id": "manual", "volume_id": volumeID, "status": "available",
+			"created_at": now.Add(-48 * time.Hour).Format("2006-01-02T15:04:05.000000"),
+			"metadata":   map[string]string{},
+		},
+	}
+	var backups []map[string]any
+
+	fakeServer.Mux.HandleFunc("/snapshots/detail", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		assert.Equal(t, volumeID, r.URL.Query().Get("volume_id"))
+		var list []map[string]any
+		for _, s := range snapshots {
+			list = append(list, s)
+		}
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"snapshots": list})
+	})
+	fakeServer.Mux.HandleFunc("/snapshots/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Split(strings.TrimPrefix(r.URL.Path, "/snapshots/"), "/")[0]
+		s, ok := snapshots[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET":
+			json.NewEncoder(w).Encode(map[string]any{"snapshot": s})
+		case r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/metadata"):
+			var req map[string]map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			assert.Equal(t, "bk-"+id, req["metadata"][tierBackupKey])
+			s["metadata"] = req["metadata"]
+			json.NewEncoder(w).Encode(req)
+		case r.Method == "DELETE":
+			delete(snapshots, id)
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+	fakeServer.Mux.HandleFunc("/backups", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		var req struct {
+			Backup struct {
+				SnapshotID string            `json:"snapshot_id"`
+				Metadata   map[string]string `json:"metadata"`
+			} `json:"backup"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		id := "bk-" + req.Backup.SnapshotID
+		backups = append(backups, map[string]any{"id": id, "status": "available", "metadata": req.Backup.Metadata})
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, `{"backup": {"id": "%s"}}`, id)
+	})
+	fakeServer.Mux.HandleFunc("/backups/detail", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		// the backups are filtered on the server side
+		var filter map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(r.URL.Query().Get("metadata")), &filter))
+		var list []map[string]any
+		for _, backup := range backups {
+			if backup["metadata"].(map[string]string)[tierSnapshotKey] == filter[tierSnapshotKey] {
+				list = append(list, backup)
+			}
+		}
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"backups": list})
+	})
+	fakeServer.Mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"versions": [{"id": "v3.0", "status": "CURRENT", "version": "3.60", "min_version": "3.0"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/backups/bk-old", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"backup": {"id": "bk-old", "status": "available"}}`)
+	})
+
+	store := BlockStore{
+		client:        fakeClient.ServiceClient(fakeServer),
+		log:           logrus.New(),
+		config:        map[string]string{"method": "snapshot"},
+		tierAfter:     24 * 3600,
+		backupTimeout: 3,
+	}
+
+	store.tierSnapshots(store.log.WithField("volumeID", volumeID), volumeID)
+	assert.Len(t, backups, 1)
+	assert.NotContains(t, snapshots, "old", "converted snapshot must be deleted")
+	assert.Contains(t, snapshots, "recent")
+	assert.Contains(t, snapshots, "manual")
+	assert.Contains(t, snapshots, "other-location", "snapshots of locations without tiering must be kept")
+	assert.Equal(t, "old", backups[0]["metadata"].(map[string]string)[tierSnapshotKey])
+	assert.Equal(t, "daily-1", backups[0]["metadata"].(map[string]string)[veleroBackupKey])
+
+	// the converted snapshot resolves to the backup
+	backupID, ok, err := store.resolveTieredSnapshot("old")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "bk-old", backupID)
+
+	_, ok, err = store.resolveTieredSnapshot("recent")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// converted snapshots are resolved even when tiering was disabled
+	store.tierAfter = 0
+	bk, backupID, _, err := store.forSnapshot("snapshot:old")
+	assert.NoError(t, err)
+	assert.Equal(t, "backup", bk.config["method"])
+	assert.Equal(t, "bk-old", backupID)
+}
+
+func TestTriggerTiering(t *testing.T) {
+	store := NewBlockStore(logrus.New())
+
+	// tiering is disabled
+	store.triggerTiering()
+	assert.Empty(t, store.tierTrigger)
+
+	// pending requests are merged into a single pass
+	store.tierAfter = 24 * 3600
+	store.triggerTiering()
+	store.triggerTiering()
+	assert.Len(t, store.tierTrigger, 1)
+}
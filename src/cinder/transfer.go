@@ -0,0 +1,108 @@
+package cinder
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/transfers"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+)
+
+// transferProject returns the OpenStack project, which the restored volume
+// belongs to. The PVC namespace is mapped to a project using the
+// transferProjects map, then the project ID is looked up in the PV
+// annotations and labels. The namespace map wins, because the restored PV
+// annotations and labels may still refer to the project of the backed up
+// volume.
+func (b *BlockStore) transferProject(pv *v1.PersistentVolume) string {
+	if pv.Spec.ClaimRef != nil {
+		if projectID, ok := b.transferProjects[pv.Spec.ClaimRef.Namespace]; ok {
+			return projectID
+		}
+	}
+	if projectID := pv.Annotations[utils.ProjectIDAnnotation]; projectID != "" {
+		return projectID
+	}
+	return pv.Labels[utils.ProjectIDAnnotation]
+}
+
+// setTransferProject annotates the PV with the project of the transferred
+// volume and drops the trust ID carried over from the backed up PV, so later
+// backups of the PV use the target project trust
+func setTransferProject(pv *v1.PersistentVolume, projectID, trustID string) {
+	if pv.Annotations == nil {
+		pv.Annotations = make(map[string]string)
+	}
+	pv.Annotations[utils.ProjectIDAnnotation] = projectID
+	if pv.Annotations[utils.TrustIDAnnotation] != trustID {
+		delete(pv.Annotations, utils.TrustIDAnnotation)
+	}
+	if pv.Labels[utils.TrustIDAnnotation] != trustID {
+		delete(pv.Labels, utils.TrustIDAnnotation)
+	}
+}
+
+// transferVolume transfers the restored volume into the project of the PV
+// using a volume transfer request accepted with the trust-scoped token of the
+// target project
+func (b *BlockStore) transferVolume(logWithFields *logrus.Entry, pv *v1.PersistentVolume, volumeID string) error {
+	projectID := b.transferProject(pv)
+	if projectID == "" {
+		return nil
+	}
+	trustID, ok := b.trusts[projectID]
+	if !ok {
+		return fmt.Errorf("cannot find a trust ID for %q project in trusts config variable", projectID)
+	}
+
+	currentTrustID := b.trustCache.VolumeTrustID(volumeID, b.config["trustID"])
+	if currentTrustID == trustID {
+		setTransferProject(pv, projectID, trustID)
+		return nil
+	}
+
+	src, err := b.withTrust(currentTrustID)
+	if err != nil {
+		return err
+	}
+	dst, err := b.withTrust(trustID)
+	if err != nil {
+		return err
+	}
+
+	logWithFields = logWithFields.WithFields(logrus.Fields{
+		"projectID": projectID,
+		"trustID":   trustID,
+	})
+	logWithFields.Info("Transferring restored volume into the target project")
+
+	opts := transfers.CreateOpts{
+		VolumeID: volumeID,
+		Name:     fmt.Sprintf("velero-restore-%s", volumeID),
+	}
+	transfer, err := transfers.Create(context.TODO(), src.client, opts).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to create transfer of volume %v: %w", volumeID, utils.WrapError(err))
+	}
+
+	_, err = transfers.Accept(context.TODO(), dst.client, transfer.ID, transfers.AcceptOpts{AuthKey: transfer.AuthKey}).Extract()
+	if err != nil {
+		if err := transfers.Delete(context.TODO(), src.client, transfer.ID).ExtractErr(); err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete a %s volume transfer", transfer.ID)
+		}
+		return fmt.Errorf("failed to accept transfer %v of volume %v in %v project: %w", transfer.ID, volumeID, projectID, utils.WrapError(err))
+	}
+
+	// the volume is accessed with the target project trust from now on
+	b.trustCache.SetVolumeTrustID(volumeID, trustID)
+
+	// later backups of the PV must use the target project trust as well
+	setTransferProject(pv, projectID, trustID)
+
+	logWithFields.WithFields(logrus.Fields{
+		"transferID": transfer.ID,
+	}).Info("Restored volume was transferred into the target project")
+	return nil
+}
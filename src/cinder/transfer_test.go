@@ -0,0 +1,121 @@
+package cinder
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Lirt/velero-plugin-for-openstack/src/utils"
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTransferVolume(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	volumeID := "1bea47ed-f6a9-463b-b423-14b9cca9ad27"
+	transferID := "8c6ef58c-6d9b-4b7a-9d3a-5fe5ee9f1c3e"
+	accepted := 0
+
+	fakeServer.Mux.HandleFunc("/os-volume-transfer", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		th.TestJSONRequest(t, r, fmt.Sprintf(`{"transfer": {"volume_id": "%s", "name": "velero-restore-%s"}}`, volumeID, volumeID))
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, `{"transfer": {"id": "%s", "auth_key": "secret", "volume_id": "%s"}}`, transferID, volumeID)
+	})
+	fakeServer.Mux.HandleFunc("/os-volume-transfer/"+transferID+"/accept", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		th.TestJSONRequest(t, r, `{"accept": {"auth_key": "secret"}}`)
+		accepted++
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, `{"transfer": {"id": "%s", "volume_id": "%s"}}`, transferID, volumeID)
+	})
+
+	store := BlockStore{
+		client:           fakeClient.ServiceClient(fakeServer),
+		log:              logrus.New(),
+		config:           map[string]string{},
+		trusts:           map[string]string{"project-a": "trust-a", "project-b": "trust-b"},
+		trustCache:       &utils.TrustCache[*BlockStore]{},
+		volumeTransfer:   true,
+		transferProjects: map[string]string{"team-b": "project-b"},
+	}
+	for _, trustID := range []string{"trust-a", "trust-b"} {
+		target := store
+		target.config = map[string]string{"trustID": trustID}
+		store.trustCache.GetOrCreate(trustID, func() (*BlockStore, error) {
+			return &target, nil
+		})
+	}
+	logWithFields := store.log.WithFields(logrus.Fields{"volumeID": volumeID})
+
+	// the namespace is mapped to the project
+	pv := &v1.PersistentVolume{
+		Spec: v1.PersistentVolumeSpec{
+			ClaimRef: &v1.ObjectReference{Namespace: "team-b"},
+		},
+	}
+	err := store.transferVolume(logWithFields, pv, volumeID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, accepted)
+	assert.Equal(t, "trust-b", store.trustCache.VolumeTrustID(volumeID, ""))
+	assert.Equal(t, "project-b", pv.Annotations[utils.ProjectIDAnnotation])
+
+	// the volume is already in the project
+	err = store.transferVolume(logWithFields, pv, volumeID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, accepted)
+
+	// the namespace map wins over the project and trust carried over from
+	// the backed up PV
+	pv = &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{utils.ProjectIDAnnotation: "project-a"},
+			Labels:      map[string]string{utils.TrustIDAnnotation: "trust-a"},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			ClaimRef: &v1.ObjectReference{Namespace: "team-b"},
+		},
+	}
+	err = store.transferVolume(logWithFields, pv, volumeID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, accepted)
+	assert.Equal(t, "project-b", pv.Annotations[utils.ProjectIDAnnotation])
+	assert.NotContains(t, pv.Labels, utils.TrustIDAnnotation)
+
+	// the project annotation is used for unmapped namespaces
+	pv = &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{utils.ProjectIDAnnotation: "project-a"},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			ClaimRef: &v1.ObjectReference{Namespace: "team-c"},
+		},
+	}
+	err = store.transferVolume(logWithFields, pv, volumeID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, accepted)
+	assert.Equal(t, "trust-a", store.trustCache.VolumeTrustID(volumeID, ""))
+
+	// no trust for the project
+	pv.Annotations[utils.ProjectIDAnnotation] = "project-c"
+	err = store.transferVolume(logWithFields, pv, volumeID)
+	assert.Error(t, err)
+
+	// unmapped namespaces without a project are not transferred
+	pv = &v1.PersistentVolume{
+		Spec: v1.PersistentVolumeSpec{
+			ClaimRef: &v1.ObjectReference{Namespace: "team-c"},
+		},
+	}
+	err = store.transferVolume(logWithFields, pv, volumeID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, accepted)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/apiversions"
+	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/availabilityzones"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/replicas"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shareaccessrules"
 	"github.com/gophercloud/gophercloud/v2/openstack/sharedfilesystems/v2/shares"
@@ -31,6 +32,8 @@ const (
 	replicasMicroversion       = "2.56"
 	defaultTimeout             = "5m"
 	defaultDeleteDelay         = "10s"
+	// Manila CSI topology key of the availability zone
+	csiTopologyKey = "topology.manila.csi.openstack.org/zone"
 )
 
 var (
@@ -79,12 +82,18 @@ type FSStore struct {
 	ensureDeletedDelay int
 	cascadeDelete      bool
 	enforceAZ          bool
+	availability       gophercloud.Availability
+	trusts             map[string]string
+	trustCache         *utils.TrustCache[*FSStore]
+	azMap              map[string]string
+	fallbackAZ         string
+	azCache            *utils.AZCache
 	log                logrus.FieldLogger
 }
 
 // NewFSStore instantiates a Manila Shared Filesystem Snapshotter.
 func NewFSStore(log logrus.FieldLogger) *FSStore {
-	return &FSStore{log: log}
+	return &FSStore{log: log, trustCache: &utils.TrustCache[*FSStore]{}, azCache: &utils.AZCache{}}
 }
 
 var _ velerovolumesnapshotter.VolumeSnapshotter = (*FSStore)(nil)
@@ -143,72 +152,249 @@ func (b *FSStore) Init(config map[string]string) error {
 		return fmt.Errorf("cannot parse cascadeDelete config variable: %w", err)
 	}
 
+	// parse restore availability zone options
+	b.azMap, err = utils.ParseMap(utils.GetConf(b.config, "availabilityZoneMap", ""))
+	if err != nil {
+		return fmt.Errorf("cannot parse availabilityZoneMap config variable: %w", err)
+	}
+	b.fallbackAZ = utils.GetConf(b.config, "fallbackAZ", "")
+	if b.fallbackAZ != "" && !utils.SliceContains(utils.SupportedAZFallbacks, b.fallbackAZ) {
+		return fmt.Errorf("unsupported %q fallbackAZ, supported values: %q", b.fallbackAZ, utils.SupportedAZFallbacks)
+	}
+
+	// parse the endpoint interface
+	b.availability, err = utils.GetAvailability(b.config)
+	if err != nil {
+		return err
+	}
+
+	// parse the project ID to Keystone trust ID map
+	b.trusts, err = utils.ParseMap(utils.GetConf(b.config, "trusts", ""))
+	if err != nil {
+		return fmt.Errorf("cannot parse trusts config variable: %w", err)
+	}
+
 	// Authenticate to Openstack
 	err = utils.Authenticate(&b.provider, "manila", config, b.log)
 	if err != nil {
-		return fmt.Errorf("failed to authenticate against OpenStack in shared filesystem plugin: %w", err)
+		return fmt.Errorf("failed to authenticate against OpenStack in shared filesystem plugin: %w", utils.WrapError(err))
 	}
 
 	// If we haven't set client before or we use multiple clouds - get new client
 	if b.client == nil || config["cloud"] != "" {
-		region, ok := os.LookupEnv("OS_REGION_NAME")
-		if !ok {
-			if config["region"] != "" {
-				region = config["region"]
-			} else {
-				region = ""
-			}
-		}
-		b.client, err = openstack.NewSharedFileSystemV2(b.provider, gophercloud.EndpointOpts{
-			Region: region,
-		})
+		err = b.initClient()
 		if err != nil {
-			return fmt.Errorf("failed to create manila storage client: %w", err)
+			return err
 		}
+	}
 
-		logWithFields := b.log.WithFields(logrus.Fields{
-			"endpoint": b.client.Endpoint,
-			"region":   region,
-		})
-
-		// set minimum supported Manila API microversion by default
-		b.client.Microversion = minSupportedMicroversion
-		if mv, err := b.getManilaMicroversion(); err != nil {
-			logWithFields.Warningf("Failed to obtain supported Manila microversions (using the default one: %v): %v", b.client.Microversion, err)
-		} else if b.enforceAZ {
-			// enforce new Manila path microversion
-			ok, err := utils.CompareMicroversions("lte", replicasMicroversion, mv)
-			if err != nil {
-				return fmt.Errorf("failed to compare supported Manila microversions: %w", err)
-			} else if !ok {
-				return fmt.Errorf("enforceAZ config option is not supported in your environment")
-			}
+	return nil
+}
 
-			b.client.Microversion = replicasMicroversion
-			logWithFields.Debugf("Setting the supported %v microversion", b.client.Microversion)
+// initClient creates the shared filesystem service client using the
+// authenticated provider client
+func (b *FSStore) initClient() error {
+	var err error
+	region, ok := os.LookupEnv("OS_REGION_NAME")
+	if !ok {
+		if b.config["region"] != "" {
+			region = b.config["region"]
 		} else {
-			// use GET method to obtain access rules
-			ok, err := utils.CompareMicroversions("lte", getAccessRulesMicroversion, mv)
-			if err != nil {
-				logWithFields.Warningf("Failed to compare supported Manila microversions (using the default one: %v): %v", b.client.Microversion, err)
-			}
+			region = ""
+		}
+	}
+	b.client, err = openstack.NewSharedFileSystemV2(b.provider, gophercloud.EndpointOpts{
+		Region:       region,
+		Availability: b.availability,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create manila storage client: %w", utils.WrapError(err))
+	}
 
-			if ok {
-				b.client.Microversion = getAccessRulesMicroversion
-				logWithFields.Debugf("Setting the supported %v microversion", b.client.Microversion)
-			}
+	// override the catalog endpoint, e.g. when it is not reachable from the cluster network
+	if endpoint := utils.GetConf(b.config, "manilaEndpointOverride", utils.GetEnv("OS_MANILA_ENDPOINT_OVERRIDE", "")); endpoint != "" {
+		err = utils.OverrideEndpoint(b.client, endpoint)
+		if err != nil {
+			return fmt.Errorf("failed to override manila storage client endpoint: %w", err)
 		}
+		b.log.WithFields(logrus.Fields{
+			"endpoint": b.client.Endpoint,
+		}).Info("Successfully overrode shared filesystem service client endpoint")
+	}
 
-		logWithFields.Debug("Successfully created shared filesystem service client")
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"endpoint":  b.client.Endpoint,
+		"region":    region,
+		"interface": b.availability,
+	})
+
+	// set minimum supported Manila API microversion by default
+	b.client.Microversion = minSupportedMicroversion
+	if mv, err := b.getManilaMicroversion(); err != nil {
+		logWithFields.Warningf("Failed to obtain supported Manila microversions (using the default one: %v): %v", b.client.Microversion, err)
+	} else if b.enforceAZ {
+		// enforce new Manila path microversion
+		ok, err := utils.CompareMicroversions("lte", replicasMicroversion, mv)
+		if err != nil {
+			return fmt.Errorf("failed to compare supported Manila microversions: %w", err)
+		} else if !ok {
+			return fmt.Errorf("enforceAZ config option is not supported in your environment")
+		}
+
+		b.client.Microversion = replicasMicroversion
+		logWithFields.Debugf("Setting the supported %v microversion", b.client.Microversion)
+	} else {
+		// use GET method to obtain access rules
+		ok, err := utils.CompareMicroversions("lte", getAccessRulesMicroversion, mv)
+		if err != nil {
+			logWithFields.Warningf("Failed to compare supported Manila microversions (using the default one: %v): %v", b.client.Microversion, err)
+		}
+
+		if ok {
+			b.client.Microversion = getAccessRulesMicroversion
+			logWithFields.Debugf("Setting the supported %v microversion", b.client.Microversion)
+		}
 	}
 
+	logWithFields.Debug("Successfully created shared filesystem service client")
+
 	return nil
 }
 
+// withTrust returns a filesystem store, which uses a token scoped to the
+// trust ID. The current filesystem store is returned, when the trust ID
+// matches the default one.
+func (b *FSStore) withTrust(trustID string) (*FSStore, error) {
+	if trustID == "" || trustID == b.config["trustID"] {
+		return b, nil
+	}
+
+	return b.trustCache.GetOrCreate(trustID, func() (*FSStore, error) {
+		t := *b
+		t.provider = nil
+		t.config = utils.Merge(b.config, map[string]string{"trustID": trustID})
+		t.log = b.log.WithField("trustID", trustID)
+		err := utils.Authenticate(&t.provider, "manila", t.config, t.log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate against OpenStack using %s trust in shared filesystem plugin: %w", trustID, utils.WrapError(err))
+		}
+		err = t.initClient()
+		if err != nil {
+			return nil, err
+		}
+		return &t, nil
+	})
+}
+
+// forVolume returns a filesystem store and a trust ID used to access the share
+func (b *FSStore) forVolume(volumeID string) (*FSStore, string, error) {
+	trustID := b.trustCache.VolumeTrustID(volumeID, b.config["trustID"])
+	t, err := b.withTrust(trustID)
+	return t, trustID, err
+}
+
+// withMethod returns a filesystem store, which uses the snapshot method. The
+// current filesystem store is returned, when the method matches the default
+// one.
+func (b *FSStore) withMethod(method string) *FSStore {
+	if method == "" || method == b.config["method"] {
+		return b
+	}
+
+	m := *b
+	m.config = utils.Merge(b.config, map[string]string{"method": method})
+	m.log = b.log.WithField("method", method)
+	return &m
+}
+
+// detectMethod returns the snapshot method of a snapshot ID without the
+// method prefix by probing Manila snapshots and shares. The default method is
+// probed first.
+func (b *FSStore) detectMethod(snapshotID string) (string, error) {
+	methods := []string{b.config["method"]}
+	for _, method := range supportedMethods {
+		if method != b.config["method"] {
+			methods = append(methods, method)
+		}
+	}
+
+	for _, method := range methods {
+		var err error
+		switch method {
+		case "clone":
+			_, err = shares.Get(context.TODO(), b.client, snapshotID).Extract()
+		default:
+			_, err = snapshots.Get(context.TODO(), b.client, snapshotID).Extract()
+		}
+		if err == nil {
+			return method, nil
+		}
+		if !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			return "", fmt.Errorf("failed to get %v %v: %w", method, snapshotID, utils.WrapError(err))
+		}
+	}
+
+	// the resource doesn't exist anymore, use the default method
+	return b.config["method"], nil
+}
+
+// forSnapshot returns a filesystem store for the snapshot method and trust ID
+// recorded in the snapshot ID together with the bare snapshot ID
+func (b *FSStore) forSnapshot(snapshotID string) (*FSStore, string, string, error) {
+	snapshotID, trustID := utils.SplitTrustID(snapshotID)
+	method, snapshotID := utils.SplitMethod(snapshotID, supportedMethods)
+	t, err := b.withTrust(trustID)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if method == "" {
+		method, err = t.detectMethod(snapshotID)
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	return t.withMethod(method), snapshotID, trustID, nil
+}
+
 // CreateVolumeFromSnapshot creates a new volume in the specified
 // availability zone, initialized from the provided snapshot and with the specified type.
 // IOPS is ignored as it is not used in Manila.
 func (b *FSStore) CreateVolumeFromSnapshot(snapshotID, volumeType, volumeAZ string, iops *int64) (string, error) {
+	t, snapshotID, trustID, err := b.forSnapshot(snapshotID)
+	if err != nil {
+		return "", err
+	}
+
+	logWithFields := b.log.WithFields(logrus.Fields{
+		"snapshotID": snapshotID,
+		"volumeAZ":   volumeAZ,
+	})
+	az, err := t.restoreAZ(logWithFields, snapshotID, volumeAZ)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to resolve availability zone of restored share")
+		return "", err
+	}
+
+	shareID, err := t.createVolume(snapshotID, volumeType, az)
+	if shareID != "" && trustID != "" {
+		b.trustCache.SetVolumeTrustID(shareID, trustID)
+	}
+	if err != nil {
+		return shareID, err
+	}
+
+	err = t.recordShareAZ(logWithFields.WithField("shareID", shareID), shareID, volumeAZ, az)
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to record availability zone of restored share")
+		return shareID, err
+	}
+
+	return shareID, nil
+}
+
+func (b *FSStore) createVolume(snapshotID, volumeType, volumeAZ string) (string, error) {
 	switch b.config["method"] {
 	case "clone":
 		return b.createVolumeFromClone(snapshotID, volumeType, volumeAZ)
@@ -233,16 +419,16 @@ func (b *FSStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ stri
 
 	snapshot, err := b.waitForSnapshotStatus(snapshotID, snapshotStatuses, b.snapshotTimeout)
 	if err != nil {
-		logWithFields.Error("snapshot didn't get into 'available' status within the time limit")
-		return "", fmt.Errorf("snapshot %v didn't get into 'available' status within the time limit: %w", snapshotID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("snapshot didn't get into 'available' status within the time limit")
+		return "", fmt.Errorf("snapshot %v didn't get into 'available' status within the time limit: %w", snapshotID, utils.WrapError(err))
 	}
 	logWithFields.Info("Snapshot is in 'available' status")
 
 	// get original share with its metadata
 	originShare, err := shares.Get(context.TODO(), b.client, snapshot.ShareID).Extract()
 	if err != nil {
-		logWithFields.Errorf("failed to get original share %v from manila", snapshot.ShareID)
-		return "", fmt.Errorf("failed to get original share %v from manila: %w", snapshot.ShareID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to get original share %v from manila", snapshot.ShareID)
+		return "", fmt.Errorf("failed to get original share %v from manila: %w", snapshot.ShareID, utils.WrapError(err))
 	}
 
 	// get original share access rule
@@ -269,8 +455,8 @@ func (b *FSStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ stri
 	}
 	share, err := shares.Create(context.TODO(), b.client, opts).Extract()
 	if err != nil {
-		logWithFields.Errorf("failed to create share from snapshot")
-		return "", fmt.Errorf("failed to create share %v from snapshot %v: %w", volumeName, snapshotID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to create share from snapshot")
+		return "", fmt.Errorf("failed to create share %v from snapshot %v: %w", volumeName, snapshotID, utils.WrapError(err))
 	}
 
 	// Make sure share is in available status
@@ -278,8 +464,8 @@ func (b *FSStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ stri
 
 	_, err = b.waitForShareStatus(share.ID, shareStatuses, b.shareTimeout)
 	if err != nil {
-		logWithFields.Error("share didn't get into 'available' status within the time limit")
-		return share.ID, fmt.Errorf("share %v didn't get into 'available' status within the time limit: %w", share.ID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("share didn't get into 'available' status within the time limit")
+		return share.ID, fmt.Errorf("share %v didn't get into 'available' status within the time limit: %w", share.ID, utils.WrapError(err))
 	}
 
 	var shareAccessID string
@@ -292,8 +478,8 @@ func (b *FSStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ stri
 		}
 		shareAccess, err := shares.GrantAccess(context.TODO(), b.client, share.ID, accessOpts).Extract()
 		if err != nil {
-			logWithFields.Error("failed to grant an access to manila share")
-			return share.ID, fmt.Errorf("failed to grant an access to manila share %v: %w", share.ID, err)
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to grant an access to manila share")
+			return share.ID, fmt.Errorf("failed to grant an access to manila share %v: %w", share.ID, utils.WrapError(err))
 		}
 		shareAccessID = shareAccess.ID
 	}
@@ -302,8 +488,8 @@ func (b *FSStore) createVolumeFromSnapshot(snapshotID, volumeType, volumeAZ stri
 	if b.enforceAZ && volumeAZ != "" && share.AvailabilityZone != volumeAZ {
 		err = b.changeAZ(logWithFields, share.ID, volumeAZ)
 		if err != nil {
-			logWithFields.Errorf("failed to move a share to the target %s availability zone", volumeAZ)
-			return share.ID, fmt.Errorf("failed to move a share to the target %s availability zone: %w", volumeAZ, err)
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to move a share to the target %s availability zone", volumeAZ)
+			return share.ID, fmt.Errorf("failed to move a share to the target %s availability zone: %w", volumeAZ, utils.WrapError(err))
 		}
 	}
 
@@ -346,8 +532,8 @@ func (b *FSStore) cloneShare(logWithFields *logrus.Entry, shareID, shareName, sh
 
 	originShare, err := b.waitForShareStatus(shareID, shareStatuses, b.shareTimeout)
 	if err != nil {
-		logWithFields.Error("source share didn't get into 'available' status within the time limit")
-		return "", "", fmt.Errorf("source share %v didn't get into 'available' status within the time limit: %w", shareID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("source share didn't get into 'available' status within the time limit")
+		return "", "", fmt.Errorf("source share %v didn't get into 'available' status within the time limit: %w", shareID, utils.WrapError(err))
 	}
 	logWithFields.Info("Source share clone is in 'available' status")
 
@@ -365,8 +551,8 @@ func (b *FSStore) cloneShare(logWithFields *logrus.Entry, shareID, shareName, sh
 	}
 	snapshot, err := snapshots.Create(context.TODO(), b.client, snapOpts).Extract()
 	if err != nil {
-		logWithFields.Error("failed to create an intermediate share snapshot from the source volume share")
-		return "", "", fmt.Errorf("failed to create an intermediate share snapshot from the %v source volume share: %w", shareID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create an intermediate share snapshot from the source volume share")
+		return "", "", fmt.Errorf("failed to create an intermediate share snapshot from the %v source volume share: %w", shareID, utils.WrapError(err))
 	}
 	defer func() {
 		// Delete intermediate snapshot from Manila
@@ -396,8 +582,8 @@ func (b *FSStore) cloneShare(logWithFields *logrus.Entry, shareID, shareName, sh
 
 	_, err = b.waitForSnapshotStatus(snapshot.ID, snapshotStatuses, b.snapshotTimeout)
 	if err != nil {
-		logWithFields.Error("intermediate snapshot didn't get into 'available' status within the time limit")
-		return "", "", fmt.Errorf("intermediate snapshot %v didn't get into 'available' status within the time limit: %w", snapshot.ID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("intermediate snapshot didn't get into 'available' status within the time limit")
+		return "", "", fmt.Errorf("intermediate snapshot %v didn't get into 'available' status within the time limit: %w", snapshot.ID, utils.WrapError(err))
 	}
 	logWithFields.Info("Intermediate snapshot is in 'available' status")
 
@@ -419,8 +605,8 @@ func (b *FSStore) cloneShare(logWithFields *logrus.Entry, shareID, shareName, sh
 	}
 	share, err := shares.Create(context.TODO(), b.client, opts).Extract()
 	if err != nil {
-		logWithFields.Errorf("failed to create share clone from intermediate snapshot")
-		return "", "", fmt.Errorf("failed to create share clone %v from intermediate snapshot %v: %w", shareName, snapshot.ID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to create share clone from intermediate snapshot")
+		return "", "", fmt.Errorf("failed to create share clone %v from intermediate snapshot %v: %w", shareName, snapshot.ID, utils.WrapError(err))
 	}
 
 	// Make sure share clone is in available status
@@ -428,8 +614,8 @@ func (b *FSStore) cloneShare(logWithFields *logrus.Entry, shareID, shareName, sh
 
 	_, err = b.waitForShareStatus(share.ID, shareStatuses, b.cloneTimeout)
 	if err != nil {
-		logWithFields.Error("share clone didn't get into 'available' status within the time limit")
-		return share.ID, "", fmt.Errorf("share clone %v didn't get into 'available' status within the time limit: %w", share.ID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("share clone didn't get into 'available' status within the time limit")
+		return share.ID, "", fmt.Errorf("share clone %v didn't get into 'available' status within the time limit: %w", share.ID, utils.WrapError(err))
 	}
 
 	var shareAccessID string
@@ -442,8 +628,8 @@ func (b *FSStore) cloneShare(logWithFields *logrus.Entry, shareID, shareName, sh
 		}
 		shareAccess, err := shares.GrantAccess(context.TODO(), b.client, share.ID, accessOpts).Extract()
 		if err != nil {
-			logWithFields.Error("failed to grant an access to manila share clone")
-			return share.ID, "", fmt.Errorf("failed to grant an access to manila share clone %v: %w", share.ID, err)
+			logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to grant an access to manila share clone")
+			return share.ID, "", fmt.Errorf("failed to grant an access to manila share clone %v: %w", share.ID, utils.WrapError(err))
 		}
 		shareAccessID = shareAccess.ID
 	}
@@ -452,8 +638,8 @@ func (b *FSStore) cloneShare(logWithFields *logrus.Entry, shareID, shareName, sh
 	if b.enforceAZ && shareAZ != "" && share.AvailabilityZone != shareAZ {
 		err = b.changeAZ(logWithFields, share.ID, shareAZ)
 		if err != nil {
-			logWithFields.Errorf("failed to move a share to the target %s availability zone", shareAZ)
-			return share.ID, shareAccessID, fmt.Errorf("failed to move a share to the target %s availability zone: %w", shareAZ, err)
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to move a share to the target %s availability zone", shareAZ)
+			return share.ID, shareAccessID, fmt.Errorf("failed to move a share to the target %s availability zone: %w", shareAZ, utils.WrapError(err))
 		}
 	}
 
@@ -469,10 +655,15 @@ func (b *FSStore) GetVolumeInfo(volumeID, volumeAZ string) (string, *int64, erro
 	})
 	logWithFields.Debug("FSStore.GetVolumeInfo called")
 
-	share, err := shares.Get(context.TODO(), b.client, volumeID).Extract()
+	t, _, err := b.forVolume(volumeID)
 	if err != nil {
-		logWithFields.Error("failed to get share from manila")
-		return "", nil, fmt.Errorf("failed to get share %v from manila: %w", volumeID, err)
+		return "", nil, err
+	}
+
+	share, err := shares.Get(context.TODO(), t.client, volumeID).Extract()
+	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get share from manila")
+		return "", nil, fmt.Errorf("failed to get share %v from manila: %w", volumeID, utils.WrapError(err))
 	}
 
 	return share.VolumeType, nil, nil
@@ -486,11 +677,16 @@ func (b *FSStore) IsVolumeReady(volumeID, volumeAZ string) (ready bool, err erro
 	})
 	logWithFields.Debug("FSStore.IsVolumeReady called")
 
+	t, _, err := b.forVolume(volumeID)
+	if err != nil {
+		return false, err
+	}
+
 	// Get share object from Manila
-	share, err := shares.Get(context.TODO(), b.client, volumeID).Extract()
+	share, err := shares.Get(context.TODO(), t.client, volumeID).Extract()
 	if err != nil {
-		logWithFields.Error("failed to get share from manila")
-		return false, fmt.Errorf("failed to get share %v from manila: %w", volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to get share from manila")
+		return false, fmt.Errorf("failed to get share %v from manila: %w", volumeID, utils.WrapError(err))
 	}
 
 	if utils.SliceContains(shareStatuses, share.Status) {
@@ -504,6 +700,21 @@ func (b *FSStore) IsVolumeReady(volumeID, volumeAZ string) (ready bool, err erro
 // CreateSnapshot creates a snapshot of the specified volume, and does NOT
 // apply any provided set of tags to the snapshot.
 func (b *FSStore) CreateSnapshot(volumeID, volumeAZ string, tags map[string]string) (string, error) {
+	t, trustID, err := b.forVolume(volumeID)
+	if err != nil {
+		return "", err
+	}
+
+	snapshotID, err := t.createSnapshotByMethod(volumeID, volumeAZ, tags)
+	if snapshotID != "" {
+		// record the method, so the snapshot survives the method config changes
+		snapshotID = utils.JoinTrustID(utils.JoinMethod(t.config["method"], snapshotID), trustID)
+	}
+
+	return snapshotID, err
+}
+
+func (b *FSStore) createSnapshotByMethod(volumeID, volumeAZ string, tags map[string]string) (string, error) {
 	switch b.config["method"] {
 	case "clone":
 		return b.createClone(volumeID, volumeAZ, tags)
@@ -532,14 +743,14 @@ func (b *FSStore) createSnapshot(volumeID, volumeAZ string, tags map[string]stri
 	}
 	snapshot, err := snapshots.Create(context.TODO(), b.client, opts).Extract()
 	if err != nil {
-		logWithFields.Error("failed to create snapshot from share")
-		return "", fmt.Errorf("failed to create snapshot %v from share %v: %w", snapshotName, volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create snapshot from share")
+		return "", fmt.Errorf("failed to create snapshot %v from share %v: %w", snapshotName, volumeID, utils.WrapError(err))
 	}
 
 	_, err = b.waitForSnapshotStatus(snapshot.ID, snapshotStatuses, b.snapshotTimeout)
 	if err != nil {
-		logWithFields.Error("snapshot didn't get into 'available' status within the time limit")
-		return snapshot.ID, fmt.Errorf("snapshot %v didn't get into 'available' status within the time limit: %w", snapshot.ID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("snapshot didn't get into 'available' status within the time limit")
+		return snapshot.ID, fmt.Errorf("snapshot %v didn't get into 'available' status within the time limit: %w", snapshot.ID, utils.WrapError(err))
 	}
 	logWithFields.Info("Snapshot is in 'available' status")
 
@@ -575,6 +786,15 @@ func (b *FSStore) createClone(volumeID, volumeAZ string, tags map[string]string)
 
 // DeleteSnapshot deletes the specified volume snapshot.
 func (b *FSStore) DeleteSnapshot(snapshotID string) error {
+	t, snapshotID, _, err := b.forSnapshot(snapshotID)
+	if err != nil {
+		return err
+	}
+
+	return t.deleteSnapshotByMethod(snapshotID)
+}
+
+func (b *FSStore) deleteSnapshotByMethod(snapshotID string) error {
 	switch b.config["method"] {
 	case "clone":
 		return b.deleteClone(snapshotID)
@@ -602,8 +822,8 @@ func (b *FSStore) deleteSnapshot(snapshotID string) error {
 			logWithFields.Info("snapshot is already deleted")
 			return nil
 		}
-		logWithFields.Error("failed to delete snapshot")
-		return fmt.Errorf("failed to delete snapshot %v: %w", snapshotID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete snapshot")
+		return fmt.Errorf("failed to delete snapshot %v: %w", snapshotID, utils.WrapError(err))
 	}
 
 	return nil
@@ -622,8 +842,8 @@ func (b *FSStore) deleteReplicas(logWithFields *logrus.Entry, shareID string) er
 		logWithFields.Infof("deleting the %s replica", replicaID)
 		err := b.ensureReplicaDeleted(logWithFields, replicaID, b.replicaTimeout)
 		if err != nil {
-			logWithFields.Errorf("failed to delete %s replica: %v", replicaID, err)
-			errs <- fmt.Errorf("failed to delete %s replica: %w", replicaID, err)
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete %s replica: %v", replicaID, err)
+			errs <- fmt.Errorf("failed to delete %s replica: %w", replicaID, utils.WrapError(err))
 		}
 		wg.Done()
 	}
@@ -654,7 +874,7 @@ func (b *FSStore) deleteSnapshots(logWithFields *logrus.Entry, shareID string) e
 	}
 	pages, err := snapshots.ListDetail(b.client, listOpts).AllPages(context.TODO())
 	if err != nil {
-		return fmt.Errorf("failed to list %s share snapshots: %w", shareID, err)
+		return fmt.Errorf("failed to list %s share snapshots: %w", shareID, utils.WrapError(err))
 	}
 	allSnapshots, err := snapshots.ExtractSnapshots(pages)
 	if err != nil {
@@ -667,8 +887,8 @@ func (b *FSStore) deleteSnapshots(logWithFields *logrus.Entry, shareID string) e
 		logWithFields.Infof("deleting the %s snapshot", snapshotID)
 		err := b.ensureSnapshotDeleted(logWithFields, snapshotID, b.snapshotTimeout)
 		if err != nil {
-			logWithFields.Errorf("failed to delete %s snapshot: %v", snapshotID, err)
-			errs <- fmt.Errorf("failed to delete %s snapshot: %w", snapshotID, err)
+			logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to delete %s snapshot: %v", snapshotID, err)
+			errs <- fmt.Errorf("failed to delete %s snapshot: %w", snapshotID, utils.WrapError(err))
 		}
 		wg.Done()
 	}
@@ -700,12 +920,12 @@ func (b *FSStore) deleteClone(cloneID string) error {
 		if ok, _ := utils.CompareMicroversions("lte", replicasMicroversion, b.client.Microversion); ok {
 			err := b.deleteReplicas(logWithFields, cloneID)
 			if err != nil {
-				return fmt.Errorf("failed to delete %s share replicas: %w", cloneID, err)
+				return fmt.Errorf("failed to delete %s share replicas: %w", cloneID, utils.WrapError(err))
 			}
 		}
 		err := b.deleteSnapshots(logWithFields, cloneID)
 		if err != nil {
-			return fmt.Errorf("failed to delete %s share snapshots: %w", cloneID, err)
+			return fmt.Errorf("failed to delete %s share snapshots: %w", cloneID, utils.WrapError(err))
 		}
 	}
 
@@ -721,8 +941,8 @@ func (b *FSStore) deleteClone(cloneID string) error {
 			logWithFields.Info("share clone is already deleted")
 			return nil
 		}
-		logWithFields.Error("failed to delete share clone")
-		return fmt.Errorf("failed to delete share clone %v: %w", cloneID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete share clone")
+		return fmt.Errorf("failed to delete share clone %v: %w", cloneID, utils.WrapError(err))
 	}
 
 	return nil
@@ -744,13 +964,21 @@ func (b *FSStore) GetVolumeID(unstructuredPV runtime.Unstructured) (string, erro
 		return "", nil
 	}
 
-	if pv.Spec.CSI.Driver == b.config["driver"] {
-		return pv.Spec.CSI.VolumeHandle, nil
+	if pv.Spec.CSI.Driver != b.config["driver"] {
+		b.log.Infof("Unable to handle CSI driver: %s", pv.Spec.CSI.Driver)
+		return "", nil
 	}
 
-	b.log.Infof("Unable to handle CSI driver: %s", pv.Spec.CSI.Driver)
+	// remember the trust ID to access the share in the trustor project
+	trustID, err := utils.GetTrustID(pv, b.trusts, b.config["trustID"])
+	if err != nil {
+		return "", fmt.Errorf("failed to get a trust ID for %v share: %w", pv.Spec.CSI.VolumeHandle, err)
+	}
+	if trustID != "" {
+		b.trustCache.SetVolumeTrustID(pv.Spec.CSI.VolumeHandle, trustID)
+	}
 
-	return "", nil
+	return pv.Spec.CSI.VolumeHandle, nil
 }
 
 // SetVolumeID sets the specific identifier for the PersistentVolume.
@@ -770,8 +998,13 @@ func (b *FSStore) SetVolumeID(unstructuredPV runtime.Unstructured, volumeID stri
 		return nil, fmt.Errorf("PV driver ('spec.csi.driver') doesn't match supported driver (%s)", b.config["driver"])
 	}
 
+	t, _, err := b.forVolume(volumeID)
+	if err != nil {
+		return nil, err
+	}
+
 	// get share access rule
-	rule, err := b.getShareAccessRule(logWithFields, volumeID)
+	rule, err := t.getShareAccessRule(logWithFields, volumeID)
 	if err != nil {
 		return nil, err
 	}
@@ -782,6 +1015,12 @@ func (b *FSStore) SetVolumeID(unstructuredPV runtime.Unstructured, volumeID stri
 		pv.Spec.CSI.VolumeAttributes["shareAccessID"] = rule.ID
 	}
 
+	// reflect the availability zone of the restored share in the PV topology
+	if az := b.azCache.VolumeAZ(volumeID); az != "" {
+		logWithFields.Infof("Setting %q availability zone in the PV topology", az)
+		utils.SetPVZone(pv, az, csiTopologyKey)
+	}
+
 	res, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pv)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert to unstructured PV: %w", err)
@@ -790,41 +1029,132 @@ func (b *FSStore) SetVolumeID(unstructuredPV runtime.Unstructured, volumeID stri
 	return &unstructured.Unstructured{Object: res}, nil
 }
 
+// restoreAZ returns the availability zone of the restored share. The
+// requested zone is translated using "availabilityZoneMap" and validated
+// against the Manila availability zones, when "fallbackAZ" is set. The fallback
+// applies, when the zone is not available.
+func (b *FSStore) restoreAZ(logWithFields *logrus.Entry, snapshotID, volumeAZ string) (string, error) {
+	if volumeAZ == "" {
+		return "", nil
+	}
+
+	// without a fallback policy the zone is passed to Manila as is, e.g. Manila
+	// may fall back to its default zone by itself
+	if b.fallbackAZ == "" {
+		az := volumeAZ
+		if v, ok := b.azMap[az]; ok {
+			az = v
+			logWithFields.Infof("Restoring share into %q availability zone instead of %q", az, volumeAZ)
+		}
+		return az, nil
+	}
+
+	pages, err := availabilityzones.List(b.client).AllPages(context.TODO())
+	if err != nil {
+		return "", fmt.Errorf("failed to list availability zones: %w", utils.WrapError(err))
+	}
+	allZones, err := availabilityzones.ExtractAvailabilityZones(pages)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract availability zones: %w", err)
+	}
+	zones := make([]string, 0, len(allZones))
+	for _, zone := range allZones {
+		zones = append(zones, zone.Name)
+	}
+
+	var sourceAZ string
+	if b.fallbackAZ == "same" {
+		sourceAZ, err = b.snapshotAZ(snapshotID)
+		if err != nil {
+			logWithFields.WithFields(utils.ErrorFields(err)).Warning("failed to get availability zone of the snapshot source")
+		}
+	}
+
+	az, err := utils.ResolveAZ(volumeAZ, b.azMap, zones, b.fallbackAZ, sourceAZ)
+	if err != nil {
+		return "", err
+	}
+	if az != volumeAZ {
+		logWithFields.Infof("Restoring share into %q availability zone instead of %q", az, volumeAZ)
+	}
+	return az, nil
+}
+
+// snapshotAZ returns the availability zone of the snapshot source share
+func (b *FSStore) snapshotAZ(snapshotID string) (string, error) {
+	shareID := snapshotID
+	if b.config["method"] == "snapshot" {
+		snapshot, err := snapshots.Get(context.TODO(), b.client, snapshotID).Extract()
+		if err != nil {
+			return "", fmt.Errorf("failed to get snapshot %v from manila: %w", snapshotID, utils.WrapError(err))
+		}
+		shareID = snapshot.ShareID
+	}
+
+	share, err := shares.Get(context.TODO(), b.client, shareID).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to get share %v from manila: %w", shareID, utils.WrapError(err))
+	}
+	return share.AvailabilityZone, nil
+}
+
+// recordShareAZ remembers the availability zone of the restored share, when
+// it differs from the requested one, so SetVolumeID reflects it in the PV
+// topology
+func (b *FSStore) recordShareAZ(logWithFields *logrus.Entry, shareID, volumeAZ, az string) error {
+	if az == volumeAZ {
+		return nil
+	}
+
+	if az == "" {
+		// the scheduler has chosen the availability zone
+		share, err := shares.Get(context.TODO(), b.client, shareID).Extract()
+		if err != nil {
+			return fmt.Errorf("failed to get share %v from manila: %w", shareID, utils.WrapError(err))
+		}
+		az = share.AvailabilityZone
+	}
+
+	logWithFields.Infof("Share was restored into %q availability zone", az)
+	b.azCache.SetVolumeAZ(shareID, az)
+	return nil
+}
+
 func (b *FSStore) changeAZ(logWithFields *logrus.Entry, shareID, az string) error {
 	// detect current share replica
 	replica, oldReplica, err := b.findOrCreateShareReplica(logWithFields, shareID, az)
 	if err != nil {
-		return fmt.Errorf("failed to obtain a replica for a %q share: %w", shareID, err)
+		return fmt.Errorf("failed to obtain a replica for a %q share: %w", shareID, utils.WrapError(err))
 	}
 
 	// resync replica in a new AZ
 	logWithFields.Infof("resyncing %s replica to a new availability zone", replica.ID)
 	err = replicas.Resync(context.TODO(), b.client, replica.ID).ExtractErr()
 	if err != nil {
-		return fmt.Errorf("failed to resync a %q share replica: %w", replica.ID, err)
+		return fmt.Errorf("failed to resync a %q share replica: %w", replica.ID, utils.WrapError(err))
 	}
 	_, err = b.waitForReplicaState(replica.ID, replicaInSyncStates, b.replicaTimeout)
 	if err != nil {
-		return fmt.Errorf("failed to wait for a %q share replica state: %w", replica.ID, err)
+		return fmt.Errorf("failed to wait for a %q share replica state: %w", replica.ID, utils.WrapError(err))
 	}
 
 	// promote replica in a new AZ
 	logWithFields.Infof("promoting %s replica to a new availability zone", replica.ID)
 	err = replicas.Promote(context.TODO(), b.client, replica.ID, replicas.PromoteOpts{}).ExtractErr()
 	if err != nil {
-		return fmt.Errorf("failed to promote a %q share replica: %w", replica.ID, err)
+		return fmt.Errorf("failed to promote a %q share replica: %w", replica.ID, utils.WrapError(err))
 	}
 	logWithFields.Infof("waiting for %s replica to be active in a new availability zone", replica.ID)
 	_, err = b.waitForReplicaState(replica.ID, replicaActiveStates, b.replicaTimeout)
 	if err != nil {
-		return fmt.Errorf("failed to wait for a %q share replica state: %w", replica.ID, err)
+		return fmt.Errorf("failed to wait for a %q share replica state: %w", replica.ID, utils.WrapError(err))
 	}
 
 	// checking the expected share AZ
 	logWithFields.Infof("waiting for %s share to be available in a new availability zone", shareID)
 	newShare, err := b.waitForShareStatus(shareID, shareStatuses, b.shareTimeout)
 	if err != nil {
-		return fmt.Errorf("failed to wait for a share: %w", err)
+		return fmt.Errorf("failed to wait for a share: %w", utils.WrapError(err))
 	}
 	if newShare.AvailabilityZone != az {
 		return fmt.Errorf("the expected share availability zone was not set")
@@ -838,7 +1168,7 @@ func (b *FSStore) changeAZ(logWithFields *logrus.Entry, shareID, az string) erro
 		}
 		err = replicas.Delete(context.TODO(), b.client, oldReplica.ID).ExtractErr()
 		if err != nil {
-			return fmt.Errorf("failed to delete an old %q replica: %w", oldReplica.ID, err)
+			return fmt.Errorf("failed to delete an old %q replica: %w", oldReplica.ID, utils.WrapError(err))
 		}
 	}
 
@@ -875,12 +1205,12 @@ func (b *FSStore) findOrCreateShareReplica(logWithFields *logrus.Entry, shareID,
 	}
 	replica, err := replicas.Create(context.TODO(), b.client, replicaOpts).Extract()
 	if err != nil {
-		return nil, curReplica, fmt.Errorf("failed to create a new replica for a %q share: %w", shareID, err)
+		return nil, curReplica, fmt.Errorf("failed to create a new replica for a %q share: %w", shareID, utils.WrapError(err))
 	}
 	logWithFields.Infof("waiting for a new %s replica to be available", replica.ID)
 	replica, err = b.waitForReplicaStatus(replica.ID, replicaStatuses, b.replicaTimeout)
 	if err != nil {
-		return nil, curReplica, fmt.Errorf("failed to wait for a %q share replica status: %w", replica.ID, err)
+		return nil, curReplica, fmt.Errorf("failed to wait for a %q share replica status: %w", replica.ID, utils.WrapError(err))
 	}
 
 	return replica, curReplica, nil
@@ -894,7 +1224,7 @@ func (b *FSStore) findShareActiveReplica(logWithFields *logrus.Entry, shareID st
 	}
 	pages, err := replicas.ListDetail(b.client, listOpts).AllPages(context.TODO())
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list %s share replicas: %w", shareID, err)
+		return nil, nil, fmt.Errorf("failed to list %s share replicas: %w", shareID, utils.WrapError(err))
 	}
 	allReplicas, err := replicas.ExtractReplicas(pages)
 	if err != nil {
@@ -924,8 +1254,8 @@ func (b *FSStore) getShareAccessRule(logWithFields *logrus.Entry, volumeID strin
 		rules, err = shares.ListAccessRights(context.TODO(), b.client, volumeID).Extract()
 	}
 	if err != nil {
-		logWithFields.Errorf("failed to list share %v access rules from manila", volumeID)
-		return nil, fmt.Errorf("failed to list share %v access rules from manila: %w", volumeID, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Errorf("failed to list share %v access rules from manila", volumeID)
+		return nil, fmt.Errorf("failed to list share %v access rules from manila: %w", volumeID, utils.WrapError(err))
 	}
 
 	switch rules := rules.(type) {
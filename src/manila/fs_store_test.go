@@ -9,6 +9,7 @@ import (
 	th "github.com/gophercloud/gophercloud/v2/testhelper"
 	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 )
 
 const ID = "0123456789"
@@ -174,3 +175,164 @@ func TestSimpleSharedFilesystemInit(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestForSnapshot(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	snapshotID := "3fbbcccf-d058-4502-8844-6feeffdf4cb5"
+	cloneID := "b6f4e0a6-1d4c-4a59-9f28-6ad3e1f4b1c2"
+	probes := 0
+
+	fakeServer.Mux.HandleFunc("/snapshots/"+snapshotID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		probes++
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"snapshot": {"id": "%s", "status": "available"}}`, snapshotID)
+	})
+	fakeServer.Mux.HandleFunc("/snapshots/"+cloneID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		probes++
+		w.WriteHeader(http.StatusNotFound)
+	})
+	fakeServer.Mux.HandleFunc("/shares/"+cloneID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		probes++
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"share": {"id": "%s", "status": "available"}}`, cloneID)
+	})
+
+	store := NewFSStore(logrus.New())
+	store.client = fakeClient.ServiceClient(fakeServer)
+	store.config = map[string]string{"method": "snapshot"}
+
+	// the method prefix is used as is
+	for id, method := range map[string]string{
+		"snapshot:" + snapshotID: "snapshot",
+		"clone:" + cloneID:       "clone",
+	} {
+		s, bareID, trustID, err := store.forSnapshot(id)
+		assert.NoError(t, err)
+		assert.Equal(t, method, s.config["method"])
+		assert.NotContains(t, bareID, ":")
+		assert.Empty(t, trustID)
+	}
+	assert.Equal(t, 0, probes)
+
+	// IDs without the method prefix created before the method change are
+	// detected, the default method is probed first
+	s, bareID, _, err := store.forSnapshot(snapshotID)
+	assert.NoError(t, err)
+	assert.Equal(t, "snapshot", s.config["method"])
+	assert.Equal(t, snapshotID, bareID)
+	assert.Equal(t, 1, probes)
+
+	s, bareID, _, err = store.forSnapshot(cloneID)
+	assert.NoError(t, err)
+	assert.Equal(t, "clone", s.config["method"])
+	assert.Equal(t, cloneID, bareID)
+	assert.Equal(t, 3, probes)
+
+	// the default method is used, when the resource doesn't exist anymore
+	method, err := store.withMethod("clone").detectMethod("unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, "clone", method)
+}
+
+func TestDeleteSnapshotDetectMethod(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	cloneID := "b6f4e0a6-1d4c-4a59-9f28-6ad3e1f4b1c2"
+	deleted := false
+
+	fakeServer.Mux.HandleFunc("/snapshots/"+cloneID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.WriteHeader(http.StatusNotFound)
+	})
+	fakeServer.Mux.HandleFunc("/shares/"+cloneID, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"share": {"id": "%s", "status": "available"}}`, cloneID)
+		case "DELETE":
+			deleted = true
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+
+	// a clone ID without the method prefix created before the method change
+	store := NewFSStore(logrus.New())
+	store.client = fakeClient.ServiceClient(fakeServer)
+	store.config = map[string]string{"method": "snapshot"}
+
+	assert.NoError(t, store.DeleteSnapshot(cloneID))
+	assert.True(t, deleted)
+}
+
+func TestRestoreAZ(t *testing.T) {
+	fakeServer := th.SetupHTTP()
+	defer fakeServer.Teardown()
+
+	shareID := "b0b9a8b3-7a4f-4ab2-8b41-5b2c0c1e8d1f"
+
+	fakeServer.Mux.HandleFunc("/os-availability-zone", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"availability_zones": [{"id": "1", "name": "az1"}, {"id": "2", "name": "az2"}]}`)
+	})
+	fakeServer.Mux.HandleFunc("/snapshots/snap1", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"snapshot": {"id": "snap1", "share_id": "src", "status": "available"}}`)
+	})
+	fakeServer.Mux.HandleFunc("/shares/src", func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprint(w, `{"share": {"id": "src", "status": "available", "availability_zone": "az2"}}`)
+	})
+	fakeServer.Mux.HandleFunc("/shares/"+shareID, func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "GET")
+		w.Header().Add("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"share": {"id": "%s", "status": "available", "availability_zone": "az1"}}`, shareID)
+	})
+
+	store := NewFSStore(logrus.New())
+	store.client = fakeClient.ServiceClient(fakeServer)
+	store.config = map[string]string{"method": "snapshot"}
+	store.azMap = map[string]string{"old-az1": "az1"}
+	store.fallbackAZ = "same"
+	logWithFields := store.log.WithFields(logrus.Fields{})
+
+	az, err := store.restoreAZ(logWithFields, "snap1", "old-az1")
+	assert.NoError(t, err)
+	assert.Equal(t, "az1", az)
+
+	az, err = store.restoreAZ(logWithFields, "snap1", "az3")
+	assert.NoError(t, err)
+	assert.Equal(t, "az2", az)
+
+	store.fallbackAZ = "fail"
+	_, err = store.restoreAZ(logWithFields, "snap1", "az3")
+	assert.Error(t, err)
+
+	// without a fallback the zone is only mapped and passed as is
+	store.fallbackAZ = ""
+	az, err = store.restoreAZ(logWithFields, "snap1", "az3")
+	assert.NoError(t, err)
+	assert.Equal(t, "az3", az)
+	az, err = store.restoreAZ(logWithFields, "snap1", "old-az1")
+	assert.NoError(t, err)
+	assert.Equal(t, "az1", az)
+
+	// the zone is recorded only when it differs from the requested one
+	assert.NoError(t, store.recordShareAZ(logWithFields, shareID, "az2", "az2"))
+	assert.Empty(t, store.azCache.VolumeAZ(shareID))
+
+	assert.NoError(t, store.recordShareAZ(logWithFields, shareID, "az3", "az2"))
+	assert.Equal(t, "az2", store.azCache.VolumeAZ(shareID))
+
+	// the zone chosen by the scheduler is read from the share
+	assert.NoError(t, store.recordShareAZ(logWithFields, shareID, "az3", ""))
+	assert.Equal(t, "az1", store.azCache.VolumeAZ(shareID))
+}
@@ -38,9 +38,16 @@ func (o *ObjectStore) Init(config map[string]string) error {
 		"config": config,
 	}).Debug("ObjectStore.Init called")
 
-	err := utils.Authenticate(&o.provider, "swift", config, o.log)
+	// parse the endpoint interface
+	availability, err := utils.GetAvailability(config)
 	if err != nil {
-		return fmt.Errorf("failed to authenticate against OpenStack in object storage plugin: %w", err)
+		return err
+	}
+
+	err = utils.Authenticate(&o.provider, "swift", config, o.log)
+	if err != nil {
+		o.log.WithFields(utils.ErrorFields(err)).Error("failed to authenticate against OpenStack")
+		return fmt.Errorf("failed to authenticate against OpenStack in object storage plugin: %w", utils.WrapError(err))
 	}
 
 	// If we haven't set client before or we use multiple clouds - get new client
@@ -57,13 +64,16 @@ func (o *ObjectStore) Init(config map[string]string) error {
 			}
 		}
 		o.client, err = openstack.NewObjectStorageV1(o.provider, gophercloud.EndpointOpts{
-			Region: region,
+			Region:       region,
+			Availability: availability,
 		})
 		if err != nil {
-			return fmt.Errorf("failed to create swift storage object: %w", err)
+			o.log.WithFields(utils.ErrorFields(err)).Error("failed to create swift storage client")
+			return fmt.Errorf("failed to create swift storage object: %w", utils.WrapError(err))
 		}
 		o.log.WithFields(logrus.Fields{
-			"region": region,
+			"region":    region,
+			"interface": availability,
 		}).Debug("Successfully created object storage service client")
 	}
 
@@ -126,14 +136,16 @@ func (o *ObjectStore) Init(config map[string]string) error {
 
 // GetObject returns body of Swift object defined by container name and object
 func (o *ObjectStore) GetObject(container, object string) (io.ReadCloser, error) {
-	o.log.WithFields(logrus.Fields{
+	logWithFields := o.log.WithFields(logrus.Fields{
 		"container": container,
 		"object":    object,
-	}).Debug("ObjectStore.GetObject called")
+	})
+	logWithFields.Debug("ObjectStore.GetObject called")
 
 	res := objects.Download(context.TODO(), o.client, container, object, nil)
 	if res.Err != nil {
-		return nil, fmt.Errorf("failed to download contents of %q object from %q container: %w", object, container, res.Err)
+		logWithFields.WithFields(utils.ErrorFields(res.Err)).Error("failed to download object")
+		return nil, fmt.Errorf("failed to download contents of %q object from %q container: %w", object, container, utils.WrapError(res.Err))
 	}
 
 	return res.Body, nil
@@ -141,17 +153,19 @@ func (o *ObjectStore) GetObject(container, object string) (io.ReadCloser, error)
 
 // PutObject uploads new object into container
 func (o *ObjectStore) PutObject(container string, object string, body io.Reader) error {
-	o.log.WithFields(logrus.Fields{
+	logWithFields := o.log.WithFields(logrus.Fields{
 		"container": container,
 		"object":    object,
-	}).Debug("ObjectStore.PutObject called")
+	})
+	logWithFields.Debug("ObjectStore.PutObject called")
 
 	createOpts := objects.CreateOpts{
 		Content: body,
 	}
 
 	if _, err := objects.Create(context.TODO(), o.client, container, object, createOpts).Extract(); err != nil {
-		return fmt.Errorf("failed to create new %q object in %q container: %w", object, container, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create object")
+		return fmt.Errorf("failed to create new %q object in %q container: %w", object, container, utils.WrapError(err))
 	}
 
 	return nil
@@ -171,7 +185,8 @@ func (o *ObjectStore) ObjectExists(container, object string) (bool, error) {
 			logWithFields.Info("Object doesn't yet exist in container")
 			return false, nil
 		}
-		return false, fmt.Errorf("cannot Get %q object from %q container: %w", object, container, res.Err)
+		logWithFields.WithFields(utils.ErrorFields(res.Err)).Error("failed to get object")
+		return false, fmt.Errorf("cannot Get %q object from %q container: %w", object, container, utils.WrapError(res.Err))
 	}
 
 	return true, nil
@@ -179,11 +194,12 @@ func (o *ObjectStore) ObjectExists(container, object string) (bool, error) {
 
 // ListCommonPrefixes returns list of objects in container, that match specified prefix
 func (o *ObjectStore) ListCommonPrefixes(container, prefix, delimiter string) ([]string, error) {
-	o.log.WithFields(logrus.Fields{
+	logWithFields := o.log.WithFields(logrus.Fields{
 		"container": container,
 		"prefix":    prefix,
 		"delimiter": delimiter,
-	}).Debug("ObjectStore.ListCommonPrefixes called")
+	})
+	logWithFields.Debug("ObjectStore.ListCommonPrefixes called")
 
 	opts := objects.ListOpts{
 		Prefix:    prefix,
@@ -192,11 +208,13 @@ func (o *ObjectStore) ListCommonPrefixes(container, prefix, delimiter string) ([
 
 	allPages, err := objects.List(o.client, container, opts).AllPages(context.TODO())
 	if err != nil {
-		return nil, fmt.Errorf("failed to list objects in %q container: %w", container, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to list objects")
+		return nil, fmt.Errorf("failed to list objects in %q container: %w", container, utils.WrapError(err))
 	}
 
 	allObjects, err := objects.ExtractInfo(allPages)
 	if err != nil {
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to extract objects info")
 		return nil, fmt.Errorf("failed to extract objects info from %q container: %w", container, err)
 	}
 
@@ -237,7 +255,8 @@ func (o *ObjectStore) DeleteObject(container, object string) error {
 			logWithFields.Info("object is already deleted")
 			return nil
 		}
-		return fmt.Errorf("failed to delete %q object from %q container: %w", object, container, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to delete object")
+		return fmt.Errorf("failed to delete %q object from %q container: %w", object, container, utils.WrapError(err))
 	}
 
 	return nil
@@ -245,11 +264,12 @@ func (o *ObjectStore) DeleteObject(container, object string) error {
 
 // CreateSignedURL creates temporary URL for object in container
 func (o *ObjectStore) CreateSignedURL(container, object string, ttl time.Duration) (string, error) {
-	o.log.WithFields(logrus.Fields{
+	logWithFields := o.log.WithFields(logrus.Fields{
 		"container": container,
 		"object":    object,
 		"ttl":       ttl,
-	}).Debug("ObjectStore.CreateSignedURL called")
+	})
+	logWithFields.Debug("ObjectStore.CreateSignedURL called")
 
 	url, err := objects.CreateTempURL(context.TODO(), o.client, container, object, objects.CreateTempURLOpts{
 		Method:     http.MethodGet,
@@ -258,7 +278,8 @@ func (o *ObjectStore) CreateSignedURL(container, object string, ttl time.Duratio
 		Digest:     o.tempURLDigest,
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to create temporary URL for %q object in %q container: %w", object, container, err)
+		logWithFields.WithFields(utils.ErrorFields(err)).Error("failed to create temporary URL")
+		return "", fmt.Errorf("failed to create temporary URL for %q object in %q container: %w", object, container, utils.WrapError(err))
 	}
 
 	return url, nil
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/gophercloud/utils/v2/client"
 	"github.com/gophercloud/utils/v2/openstack/clientconfig"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http/httpproxy"
 )
 
 // osDebugger satisfies the client.Logger interface to print debug API logs
@@ -44,7 +46,9 @@ func Authenticate(pc **gophercloud.ProviderClient, service string, config map[st
 		}
 	}
 
-	if _, ok := os.LookupEnv("OS_SWIFT_AUTH_URL"); ok && service == "swift" {
+	_, swiftAuth := os.LookupEnv("OS_SWIFT_AUTH_URL")
+	swiftAuth = swiftAuth && service == "swift"
+	if swiftAuth {
 		log.Debugf("Trying to authenticate against SwiftStack using special swift environment variables (see README.md)")
 
 		clientOpts.AuthInfo = &clientconfig.AuthInfo{
@@ -72,6 +76,20 @@ func Authenticate(pc **gophercloud.ProviderClient, service string, config map[st
 		}
 	}
 
+	// the rotated application credential is read from the Kubernetes Secret,
+	// the environment variables are not updated after the rotation
+	var rotated *appCredential
+	if clientOpts.Cloud == "" && !swiftAuth && config["trustID"] == "" {
+		if service != rotationService {
+			startCredentialRotation(log)
+		}
+		if rotator != nil {
+			cred := rotator.credential()
+			rotated = &cred
+			clientOpts.AuthInfo = cred.authInfo()
+		}
+	}
+
 	tlsVerify, err := strconv.ParseBool(GetEnv("TLS_SKIP_VERIFY", "false"))
 	if err != nil {
 		return fmt.Errorf("cannot parse boolean from TLS_SKIP_VERIFY environment variable: %w", err)
@@ -80,12 +98,24 @@ func Authenticate(pc **gophercloud.ProviderClient, service string, config map[st
 	tlsConfig := &tls.Config{InsecureSkipVerify: tlsVerify}
 	transport := http.DefaultTransport.(*http.Transport).Clone()
 	transport.TLSClientConfig = tlsConfig
+	transport.Proxy, err = getProxyFunc(config)
+	if err != nil {
+		return err
+	}
 
 	ao, err := clientconfig.AuthOptions(&clientOpts)
 	if err != nil {
 		return fmt.Errorf("failed to build auth options: %w", err)
 	}
 
+	// use a trust-scoped token to act on behalf of the trustor project
+	if trustID := config["trustID"]; trustID != "" {
+		log.Debugf("Authentication will be done using a %v trust-scoped token", trustID)
+		ao.Scope = &gophercloud.AuthScope{TrustID: trustID}
+		ao.TenantID = ""
+		ao.TenantName = ""
+	}
+
 	*pc, err = openstack.NewClient(ao.IdentityEndpoint)
 	if err != nil {
 		return fmt.Errorf("failed to create a provider: %w", err)
@@ -113,5 +143,43 @@ func Authenticate(pc **gophercloud.ProviderClient, service string, config map[st
 
 	log.Debugf("Authentication against identity endpoint %v was successful", (*pc).IdentityEndpoint)
 
+	// re-authenticate the provider client after the application credential
+	// rotation
+	if rotated != nil && service != rotationService {
+		rotator.register(*pc, *rotated)
+	}
+
 	return nil
 }
+
+// getProxyFunc returns a proxy function for the HTTP transport. The httpProxy
+// and noProxy config values take precedence over the standard HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY environment variables.
+func getProxyFunc(config map[string]string) (func(*http.Request) (*url.URL, error), error) {
+	httpProxy := GetConf(config, "httpProxy", "")
+	noProxy, noProxySet := config["noProxy"]
+	if httpProxy == "" && !noProxySet {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxyConfig := httpproxy.FromEnvironment()
+	if httpProxy != "" {
+		u, err := url.Parse(httpProxy)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse httpProxy config variable: %w", err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid %q httpProxy config variable, must be in scheme://host[:port] format", httpProxy)
+		}
+		proxyConfig.HTTPProxy = httpProxy
+		proxyConfig.HTTPSProxy = httpProxy
+	}
+	if noProxySet {
+		proxyConfig.NoProxy = noProxy
+	}
+
+	proxyFunc := proxyConfig.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
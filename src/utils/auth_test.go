@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetProxyFunc(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		url      string
+		expected string
+		err      bool
+	}{
+		{
+			name:     "proxy from config",
+			config:   map[string]string{"httpProxy": "http://proxy.example.com:3128"},
+			url:      "https://keystone.example.com:5000/v3",
+			expected: "http://proxy.example.com:3128",
+		},
+		{
+			name:     "proxy bypassed by noProxy",
+			config:   map[string]string{"httpProxy": "http://proxy.example.com:3128", "noProxy": ".example.com"},
+			url:      "https://keystone.example.com:5000/v3",
+			expected: "",
+		},
+		{
+			name:     "noProxy does not match",
+			config:   map[string]string{"httpProxy": "http://proxy.example.com:3128", "noProxy": "cloud2.com"},
+			url:      "https://keystone.example.com:5000/v3",
+			expected: "http://proxy.example.com:3128",
+		},
+		{
+			name:   "invalid proxy",
+			config: map[string]string{"httpProxy": "proxy.example.com"},
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		proxyFunc, err := getProxyFunc(tt.config)
+		if tt.err {
+			if err == nil {
+				t.Errorf("[%s] failed - expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] failed - %v", tt.name, err)
+			continue
+		}
+
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := proxyFunc(req)
+		if err != nil {
+			t.Errorf("[%s] failed - %v", tt.name, err)
+			continue
+		}
+		var proxy string
+		if u != nil {
+			proxy = u.String()
+		}
+		if proxy != tt.expected {
+			t.Errorf("[%s] failed - proxy %q doesn't match expected %q", tt.name, proxy, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2"
+	tokens2 "github.com/gophercloud/gophercloud/v2/openstack/identity/v2/tokens"
+	tokens3 "github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+)
+
+var (
+	// project ID templates used in Keystone catalog endpoints
+	projectIDTemplates = []string{
+		"%(project_id)s",
+		"%(tenant_id)s",
+		"$(project_id)s",
+		"$(tenant_id)s",
+	}
+	// regexp to detect unsupported endpoint templates
+	endpointTemplateRe = regexp.MustCompile(`[%$]\([^)]*\)s`)
+)
+
+// GetProjectID returns the project ID of the authenticated provider client
+func GetProjectID(pc *gophercloud.ProviderClient) (string, error) {
+	switch r := pc.GetAuthResult().(type) {
+	case interface {
+		ExtractProject() (*tokens3.Project, error)
+	}:
+		project, err := r.ExtractProject()
+		if err != nil {
+			return "", fmt.Errorf("failed to extract project from the token: %w", err)
+		}
+		if project != nil && project.ID != "" {
+			return project.ID, nil
+		}
+	case tokens2.CreateResult:
+		token, err := r.ExtractToken()
+		if err != nil {
+			return "", fmt.Errorf("failed to extract tenant from the token: %w", err)
+		}
+		if token.Tenant.ID != "" {
+			return token.Tenant.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("authentication token is not scoped to a project")
+}
+
+// ExpandEndpoint expands project ID templates such as %(project_id)s in the
+// endpoint override and validates the resulting URL
+func ExpandEndpoint(endpoint, projectID string) (string, error) {
+	for _, t := range projectIDTemplates {
+		endpoint = strings.ReplaceAll(endpoint, t, projectID)
+	}
+	if v := endpointTemplateRe.FindString(endpoint); v != "" {
+		return "", fmt.Errorf("unsupported %q template in %q endpoint, supported templates: %q", v, endpoint, projectIDTemplates)
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %q endpoint: %w", endpoint, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid %q endpoint, must be in scheme://host[:port][/path] format", endpoint)
+	}
+
+	return gophercloud.NormalizeURL(u.String()), nil
+}
+
+// OverrideEndpoint sets the service client endpoint to the expanded endpoint
+// override
+func OverrideEndpoint(client *gophercloud.ServiceClient, endpoint string) error {
+	var projectID string
+	if endpointTemplateRe.MatchString(endpoint) {
+		var err error
+		projectID, err = GetProjectID(client.ProviderClient)
+		if err != nil {
+			return fmt.Errorf("failed to expand %q endpoint: %w", endpoint, err)
+		}
+	}
+
+	expanded, err := ExpandEndpoint(endpoint, projectID)
+	if err != nil {
+		return err
+	}
+	client.Endpoint = expanded
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestExpandEndpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		projectID string
+		expected  string
+		err       bool
+	}{
+		{
+			name:      "endpoint with project_id template",
+			endpoint:  "https://cinder.internal:8776/v3/%(project_id)s",
+			projectID: "04982538f42b",
+			expected:  "https://cinder.internal:8776/v3/04982538f42b/",
+		},
+		{
+			name:      "endpoint with tenant_id template",
+			endpoint:  "https://cinder.internal:8776/v3/$(tenant_id)s/",
+			projectID: "04982538f42b",
+			expected:  "https://cinder.internal:8776/v3/04982538f42b/",
+		},
+		{
+			name:     "endpoint without template",
+			endpoint: "http://glance.internal:9292",
+			expected: "http://glance.internal:9292/",
+		},
+		{
+			name:     "endpoint with unsupported template",
+			endpoint: "https://cinder.internal:8776/v3/%(user_id)s",
+			err:      true,
+		},
+		{
+			name:     "endpoint without scheme",
+			endpoint: "cinder.internal:8776/v3",
+			err:      true,
+		},
+	}
+	for _, tt := range tests {
+		endpoint, err := ExpandEndpoint(tt.endpoint, tt.projectID)
+		if tt.err {
+			if err == nil {
+				t.Errorf("[%s] failed - expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] failed - %v", tt.name, err)
+		} else if endpoint != tt.expected {
+			t.Errorf("[%s] failed - output %s doesn't match expected '%s'", tt.name, endpoint, tt.expected)
+		}
+	}
+}
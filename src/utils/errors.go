@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorClass is a class of the OpenStack API error
+type ErrorClass string
+
+const (
+	// QuotaExceeded is returned when the project quota or rate limit is exceeded
+	QuotaExceeded ErrorClass = "QuotaExceeded"
+	// NotFound is returned when the resource doesn't exist
+	NotFound ErrorClass = "NotFound"
+	// Conflict is returned when the resource is locked by another operation
+	Conflict ErrorClass = "Conflict"
+	// Unauthorized is returned when the credentials are invalid or have no access
+	Unauthorized ErrorClass = "Unauthorized"
+	// Transient is returned for temporary service or network failures
+	Transient ErrorClass = "Transient"
+	// InvalidState is returned when the resource status doesn't allow the operation
+	InvalidState ErrorClass = "InvalidState"
+)
+
+var (
+	// headers with OpenStack request IDs, in order of precedence
+	requestIDHeaders = []string{
+		"X-Openstack-Request-Id",
+		"X-Compute-Request-Id",
+		"X-Trans-Id",
+		"X-Request-Id",
+	}
+	// regexp to detect quota errors in response bodies
+	quotaRe = regexp.MustCompile(`(?i)quota|limit exceeded|overlimit`)
+	// regexp to detect resource state errors in response bodies
+	invalidStateRe = regexp.MustCompile(`(?i)status|state`)
+)
+
+// OpenStackError holds the OpenStack API error details
+type OpenStackError struct {
+	Err        error
+	Class      ErrorClass
+	StatusCode int
+	RequestID  string
+	FaultCode  string
+}
+
+// Error satisfies golang error interface
+func (e *OpenStackError) Error() string {
+	var details []string
+	if e.Class != "" {
+		details = append(details, "class="+string(e.Class))
+	}
+	if e.StatusCode != 0 {
+		details = append(details, fmt.Sprintf("status=%d", e.StatusCode))
+	}
+	if e.FaultCode != "" {
+		details = append(details, "faultCode="+e.FaultCode)
+	}
+	if e.RequestID != "" {
+		details = append(details, "requestID="+e.RequestID)
+	}
+	return fmt.Sprintf("%v [%s]", e.Err, strings.Join(details, ", "))
+}
+
+// Unwrap returns the original error
+func (e *OpenStackError) Unwrap() error {
+	return e.Err
+}
+
+// Fields returns the error details as log fields
+func (e *OpenStackError) Fields() logrus.Fields {
+	fields := logrus.Fields{}
+	if e.Class != "" {
+		fields["errorClass"] = e.Class
+	}
+	if e.StatusCode != 0 {
+		fields["statusCode"] = e.StatusCode
+	}
+	if e.FaultCode != "" {
+		fields["faultCode"] = e.FaultCode
+	}
+	if e.RequestID != "" {
+		fields["requestID"] = e.RequestID
+	}
+	return fields
+}
+
+// ClassifyError extracts the OpenStack request ID, HTTP status and fault code
+// from the error and classifies it. It returns nil, when the error doesn't
+// come from OpenStack API or a network failure.
+func ClassifyError(err error) *OpenStackError {
+	if err == nil {
+		return nil
+	}
+
+	var osErr *OpenStackError
+	if errors.As(err, &osErr) {
+		return osErr
+	}
+
+	var statusErr ErrStatus
+	if errors.As(err, &statusErr) {
+		return &OpenStackError{Err: err, Class: InvalidState}
+	}
+
+	var respErr gophercloud.ErrUnexpectedResponseCode
+	if errors.As(err, &respErr) {
+		osErr = &OpenStackError{
+			Err:        err,
+			StatusCode: respErr.Actual,
+			FaultCode:  getFaultCode(respErr.Body),
+		}
+		for _, h := range requestIDHeaders {
+			if v := respErr.ResponseHeader.Get(h); v != "" {
+				osErr.RequestID = v
+				break
+			}
+		}
+		osErr.Class = classifyResponse(respErr.Actual, respErr.Body)
+		return osErr
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return &OpenStackError{Err: err, Class: Transient}
+	}
+
+	return nil
+}
+
+// WrapError adds the OpenStack error details to the error message. The error
+// is returned unchanged, when it has no details or it is already wrapped.
+func WrapError(err error) error {
+	var osErr *OpenStackError
+	if errors.As(err, &osErr) {
+		return err
+	}
+	if osErr = ClassifyError(err); osErr == nil {
+		return err
+	}
+	return osErr
+}
+
+// ErrorFields returns the OpenStack error details as log fields
+func ErrorFields(err error) logrus.Fields {
+	if osErr := ClassifyError(err); osErr != nil {
+		return osErr.Fields()
+	}
+	return logrus.Fields{}
+}
+
+// IsErrorClass returns true, when the error belongs to the class
+func IsErrorClass(err error, class ErrorClass) bool {
+	osErr := ClassifyError(err)
+	return osErr != nil && osErr.Class == class
+}
+
+func classifyResponse(statusCode int, body []byte) ErrorClass {
+	switch statusCode {
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return QuotaExceeded
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusUnauthorized:
+		return Unauthorized
+	case http.StatusForbidden:
+		if quotaRe.Match(body) {
+			return QuotaExceeded
+		}
+		return Unauthorized
+	case http.StatusBadRequest:
+		if quotaRe.Match(body) {
+			return QuotaExceeded
+		}
+		if invalidStateRe.Match(body) {
+			return InvalidState
+		}
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return Transient
+	}
+	return ""
+}
+
+// getFaultCode returns the fault code from the OpenStack error response
+// body, e.g. {"itemNotFound": {"code": 404, "message": "..."}} or
+// {"error": {"code": 401, "title": "Unauthorized", "message": "..."}}
+func getFaultCode(body []byte) string {
+	var faults map[string]json.RawMessage
+	if err := json.Unmarshal(body, &faults); err != nil || len(faults) != 1 {
+		return ""
+	}
+
+	for k, v := range faults {
+		if k != "error" {
+			return k
+		}
+		var fault struct {
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal(v, &fault); err == nil && fault.Title != "" {
+			return fault.Title
+		}
+	}
+
+	return ""
+}
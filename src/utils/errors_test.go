@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newResponseError(code int, body string, headers map[string]string) error {
+	h := http.Header{}
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	return gophercloud.ErrUnexpectedResponseCode{
+		Method:         "POST",
+		URL:            "http://localhost:8776/v3/volumes",
+		Expected:       []int{202},
+		Actual:         code,
+		Body:           []byte(body),
+		ResponseHeader: h,
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		class     ErrorClass
+		status    int
+		faultCode string
+		requestID string
+	}{
+		{
+			name:      "quota exceeded",
+			err:       newResponseError(413, `{"overLimit": {"code": 413, "message": "VolumeSizeExceedsAvailableQuota"}}`, map[string]string{"X-Openstack-Request-Id": "req-1"}),
+			class:     QuotaExceeded,
+			status:    413,
+			faultCode: "overLimit",
+			requestID: "req-1",
+		},
+		{
+			name:      "not found",
+			err:       newResponseError(404, `{"itemNotFound": {"code": 404, "message": "Volume could not be found."}}`, map[string]string{"X-Compute-Request-Id": "req-2"}),
+			class:     NotFound,
+			status:    404,
+			faultCode: "itemNotFound",
+			requestID: "req-2",
+		},
+		{
+			name:   "conflict",
+			err:    newResponseError(409, ``, nil),
+			class:  Conflict,
+			status: 409,
+		},
+		{
+			name:      "unauthorized",
+			err:       newResponseError(401, `{"error": {"code": 401, "title": "Unauthorized", "message": "The request you have made requires authentication."}}`, map[string]string{"X-Openstack-Request-Id": "req-3"}),
+			class:     Unauthorized,
+			status:    401,
+			faultCode: "Unauthorized",
+			requestID: "req-3",
+		},
+		{
+			name:      "invalid state",
+			err:       newResponseError(400, `{"badRequest": {"code": 400, "message": "Invalid volume: Volume status must be available or in-use."}}`, nil),
+			class:     InvalidState,
+			status:    400,
+			faultCode: "badRequest",
+		},
+		{
+			name:      "transient",
+			err:       newResponseError(503, `<html>Service Unavailable</html>`, map[string]string{"X-Trans-Id": "tx-4"}),
+			class:     Transient,
+			status:    503,
+			requestID: "tx-4",
+		},
+		{
+			name:  "deadline exceeded",
+			err:   fmt.Errorf("failed to wait: %w", context.DeadlineExceeded),
+			class: Transient,
+		},
+		{
+			name:  "error status",
+			err:   ErrStatus{Status: "error_deleting"},
+			class: InvalidState,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			osErr := ClassifyError(fmt.Errorf("failed: %w", tt.err))
+			if !assert.NotNil(t, osErr) {
+				return
+			}
+			assert.Equal(t, tt.class, osErr.Class)
+			assert.Equal(t, tt.status, osErr.StatusCode)
+			assert.Equal(t, tt.faultCode, osErr.FaultCode)
+			assert.Equal(t, tt.requestID, osErr.RequestID)
+			assert.True(t, IsErrorClass(tt.err, tt.class))
+		})
+	}
+
+	assert.Nil(t, ClassifyError(nil))
+	assert.Nil(t, ClassifyError(fmt.Errorf("invalid config")))
+}
+
+func TestWrapError(t *testing.T) {
+	err := newResponseError(404, `{"itemNotFound": {"code": 404}}`, map[string]string{"X-Openstack-Request-Id": "req-1"})
+
+	wrapped := fmt.Errorf("failed to get volume: %w", WrapError(err))
+	assert.Contains(t, wrapped.Error(), "[class=NotFound, status=404, faultCode=itemNotFound, requestID=req-1]")
+	assert.True(t, gophercloud.ResponseCodeIs(wrapped, http.StatusNotFound))
+
+	// already wrapped errors are not wrapped twice
+	assert.Equal(t, wrapped, WrapError(wrapped))
+
+	plain := fmt.Errorf("invalid config")
+	assert.Equal(t, plain, WrapError(plain))
+	assert.Nil(t, WrapError(nil))
+}
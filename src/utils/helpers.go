@@ -48,6 +48,23 @@ func GetConf(config map[string]string, key, fallback string) string {
 	return fallback
 }
 
+// GetAvailability returns the service endpoint interface from the "interface"
+// config value or the OS_INTERFACE environment variable. An empty value means
+// the gophercloud default, which is the public interface.
+func GetAvailability(config map[string]string) (gophercloud.Availability, error) {
+	availability := gophercloud.Availability(GetConf(config, "interface", GetEnv("OS_INTERFACE", "")))
+	switch availability {
+	case "", gophercloud.AvailabilityPublic, gophercloud.AvailabilityInternal, gophercloud.AvailabilityAdmin:
+		return availability, nil
+	}
+
+	return "", fmt.Errorf("unsupported %q endpoint interface, supported interfaces: %q", availability, []gophercloud.Availability{
+		gophercloud.AvailabilityPublic,
+		gophercloud.AvailabilityInternal,
+		gophercloud.AvailabilityAdmin,
+	})
+}
+
 // ReplaceAccount replaces an endpoint account part with a new account value
 func ReplaceAccount(account, path string, prefixes []string) string {
 	parts := strings.Split(path, "/")
@@ -133,6 +150,35 @@ func Merge(args ...map[string]string) map[string]string {
 	return m
 }
 
+// ParseMap parses a comma separated list of key=value pairs into a map
+func ParseMap(str string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid %q pair, must be in key=value format", pair)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+// ParseList parses a comma separated list of values, empty values are skipped
+func ParseList(str string) []string {
+	var l []string
+	for _, v := range strings.Split(str, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
 // DurationToSeconds parses the string into a time.Duration format and returns
 // seconds in int format
 func DurationToSeconds(str string) (int, error) {
@@ -4,6 +4,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
 )
 
 func TestReplaceAccount(t *testing.T) {
@@ -147,3 +149,74 @@ func TestDurationToSeconds(t *testing.T) {
 		}
 	}
 }
+
+func TestGetAvailability(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected gophercloud.Availability
+		err      bool
+	}{
+		"empty":    {"", "", false},
+		"public":   {"public", gophercloud.AvailabilityPublic, false},
+		"internal": {"internal", gophercloud.AvailabilityInternal, false},
+		"admin":    {"admin", gophercloud.AvailabilityAdmin, false},
+		"invalid":  {"private", "", true},
+	}
+
+	t.Setenv("OS_INTERFACE", "")
+	for name, test := range tests {
+		v, err := GetAvailability(map[string]string{"interface": test.value})
+		if test.err {
+			if err == nil {
+				t.Errorf("[%s] test failed: expected an error", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] test failed: %v", name, err)
+		} else if v != test.expected {
+			t.Errorf("[%s] test failed: expected %q, got %q", name, test.expected, v)
+		}
+	}
+}
+
+func TestParseMap(t *testing.T) {
+	tests := map[string]map[string]string{
+		"":                        {},
+		"a=b":                     {"a": "b"},
+		" a = b , c=d,":           {"a": "b", "c": "d"},
+		"ceph-ssd=snapshot,lvm=":  {"ceph-ssd": "snapshot", "lvm": ""},
+		"project1=trust1,a=b=c,d": nil,
+		"=b":                      nil,
+	}
+
+	for s, expected := range tests {
+		m, err := ParseMap(s)
+		if expected == nil {
+			if err == nil {
+				t.Errorf("[%s] test failed: expected an error", s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] test failed: %v", s, err)
+		} else if !reflect.DeepEqual(expected, m) {
+			t.Errorf("[%s] test failed: expected %q, got %q", s, expected, m)
+		}
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := map[string][]string{
+		"":             nil,
+		"a":            {"a"},
+		" a , b ,, c,": {"a", "b", "c"},
+	}
+
+	for s, expected := range tests {
+		l := ParseList(s)
+		if !reflect.DeepEqual(expected, l) {
+			t.Errorf("[%s] test failed: expected %q, got %q", s, expected, l)
+		}
+	}
+}
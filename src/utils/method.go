@@ -0,0 +1,23 @@
+package utils
+
+import "strings"
+
+const methodSeparator = ":"
+
+// JoinMethod prepends the snapshot method to the resource ID, so the resource
+// can be restored or deleted with the same method later
+func JoinMethod(method, id string) string {
+	if method == "" {
+		return id
+	}
+	return method + methodSeparator + id
+}
+
+// SplitMethod splits the snapshot method and the resource ID. An empty method
+// is returned, when the ID has no prefix of the supported methods.
+func SplitMethod(id string, methods []string) (string, string) {
+	if i := strings.Index(id, methodSeparator); i >= 0 && SliceContains(methods, id[:i]) {
+		return id[:i], id[i+1:]
+	}
+	return "", id
+}
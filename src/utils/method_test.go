@@ -0,0 +1,22 @@
+package utils
+
+import "testing"
+
+func TestSplitMethod(t *testing.T) {
+	methods := []string{"snapshot", "backup"}
+	tests := map[string][2]string{
+		"d32019d3-bc6e-4319-9c1d-6722fc136a22":        {"", "d32019d3-bc6e-4319-9c1d-6722fc136a22"},
+		"backup:d32019d3-bc6e-4319-9c1d-6722fc136a22": {"backup", "d32019d3-bc6e-4319-9c1d-6722fc136a22"},
+		"image:d32019d3-bc6e-4319-9c1d-6722fc136a22":  {"", "image:d32019d3-bc6e-4319-9c1d-6722fc136a22"},
+	}
+
+	for id, expected := range tests {
+		method, resourceID := SplitMethod(id, methods)
+		if method != expected[0] || resourceID != expected[1] {
+			t.Errorf("[%s] test failed: expected %q, got %q", id, expected, []string{method, resourceID})
+		}
+		if v := JoinMethod(method, resourceID); v != id {
+			t.Errorf("[%s] test failed: expected %q, got %q", id, id, v)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"weak"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	tokens3 "github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"github.com/gophercloud/utils/v2/openstack/clientconfig"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	appCredIDEnv                = "OS_APPLICATION_CREDENTIAL_ID"
+	appCredNameEnv              = "OS_APPLICATION_CREDENTIAL_NAME"
+	appCredSecretEnv            = "OS_APPLICATION_CREDENTIAL_SECRET"
+	rotationService             = "keystone"
+	defaultRotationInterval     = "1h"
+	defaultRotationBefore       = "168h"
+	defaultCredentialLifetime   = "720h"
+	defaultRotationGracePeriod  = "2h"
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	// Secret annotations with the replaced application credential, which is
+	// deleted after the grace period
+	previousCredentialAnnotation = "openstack.velero.io/previous-application-credential-id"
+	rotatedAtAnnotation          = "openstack.velero.io/application-credential-rotated-at"
+)
+
+var (
+	rotator     *credentialRotator
+	rotatorOnce sync.Once
+	// regexp to strip the rotation timestamp from the application credential name
+	rotatedNameRe = regexp.MustCompile(`-\d{14}$`)
+)
+
+// appCredential is the application credential stored in the Kubernetes Secret
+type appCredential struct {
+	ID     string
+	Name   string
+	Secret string
+}
+
+// credentialFromSecret returns the application credential stored in the
+// Kubernetes Secret
+func credentialFromSecret(secret *corev1.Secret) appCredential {
+	return appCredential{
+		ID:     string(secret.Data[appCredIDEnv]),
+		Name:   string(secret.Data[appCredNameEnv]),
+		Secret: string(secret.Data[appCredSecretEnv]),
+	}
+}
+
+// credentialRotator creates a new application credential before the current
+// one expires, stores it in a Kubernetes Secret and re-authenticates the
+// registered provider clients. The Secret is the source of truth: plugin
+// processes read the current credential from it and the replaced credential
+// is deleted after a grace period recorded in the Secret annotations.
+type credentialRotator struct {
+	mu           sync.Mutex
+	log          logrus.FieldLogger
+	providers    []weak.Pointer[gophercloud.ProviderClient]
+	current      appCredential
+	secrets      corev1client.SecretInterface
+	secretName   string
+	interval     time.Duration
+	rotateBefore time.Duration
+	lifetime     time.Duration
+	gracePeriod  time.Duration
+}
+
+// startCredentialRotation starts the application credential rotation, when
+// it is enabled by the OS_APPLICATION_CREDENTIAL_ROTATION environment variable
+func startCredentialRotation(log logrus.FieldLogger) {
+	rotatorOnce.Do(func() {
+		enabled, err := strconv.ParseBool(GetEnv("OS_APPLICATION_CREDENTIAL_ROTATION", "false"))
+		if err != nil {
+			log.Errorf("Application credential rotation is disabled, cannot parse OS_APPLICATION_CREDENTIAL_ROTATION environment variable: %v", err)
+			return
+		}
+		if !enabled {
+			return
+		}
+
+		r, err := newCredentialRotator(log.WithField("component", "credential-rotation"))
+		if err != nil {
+			log.Errorf("Application credential rotation is disabled: %v", err)
+			return
+		}
+		rotator = r
+
+		go r.run()
+	})
+}
+
+func newCredentialRotator(log logrus.FieldLogger) (*credentialRotator, error) {
+	if os.Getenv(appCredIDEnv) == "" && os.Getenv(appCredNameEnv) == "" {
+		return nil, fmt.Errorf("authentication doesn't use application credentials from %s or %s environment variables", appCredIDEnv, appCredNameEnv)
+	}
+
+	r := &credentialRotator{
+		log:        log,
+		secretName: os.Getenv("OS_APPLICATION_CREDENTIAL_ROTATION_SECRET"),
+	}
+	if r.secretName == "" {
+		return nil, fmt.Errorf("OS_APPLICATION_CREDENTIAL_ROTATION_SECRET environment variable must be set")
+	}
+
+	var err error
+	for env, v := range map[string]struct {
+		value    *time.Duration
+		fallback string
+	}{
+		"OS_APPLICATION_CREDENTIAL_ROTATION_INTERVAL":     {&r.interval, defaultRotationInterval},
+		"OS_APPLICATION_CREDENTIAL_ROTATION_BEFORE":       {&r.rotateBefore, defaultRotationBefore},
+		"OS_APPLICATION_CREDENTIAL_LIFETIME":              {&r.lifetime, defaultCredentialLifetime},
+		"OS_APPLICATION_CREDENTIAL_ROTATION_GRACE_PERIOD": {&r.gracePeriod, defaultRotationGracePeriod},
+	} {
+		*v.value, err = time.ParseDuration(GetEnv(env, v.fallback))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse time from %s environment variable: %w", env, err)
+		}
+	}
+	if r.rotateBefore >= r.lifetime {
+		return nil, fmt.Errorf("OS_APPLICATION_CREDENTIAL_ROTATION_BEFORE must be less than OS_APPLICATION_CREDENTIAL_LIFETIME")
+	}
+	// other plugin processes switch to the new credential within the interval
+	if r.gracePeriod <= r.interval {
+		return nil, fmt.Errorf("OS_APPLICATION_CREDENTIAL_ROTATION_GRACE_PERIOD must be greater than OS_APPLICATION_CREDENTIAL_ROTATION_INTERVAL")
+	}
+
+	namespace := GetEnv("OS_APPLICATION_CREDENTIAL_ROTATION_NAMESPACE", os.Getenv("VELERO_NAMESPACE"))
+	if namespace == "" {
+		ns, err := os.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect the secret namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+
+	clientset, err := NewKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	r.secrets = clientset.CoreV1().Secrets(namespace)
+
+	// the environment variables are not updated after the rotation, e.g. in
+	// plugin processes started later by the same Velero server
+	secret, err := r.secrets.Get(context.TODO(), r.secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %q secret: %w", r.secretName, err)
+	}
+	r.current = credentialFromSecret(secret)
+
+	return r, nil
+}
+
+// credential returns the current application credential
+func (r *credentialRotator) credential() appCredential {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// register adds the provider client authenticated using the credential to
+// the list of clients to be re-authenticated after the rotation
+func (r *credentialRotator) register(pc *gophercloud.ProviderClient, cred appCredential) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers = append(r.providers, weak.Make(pc))
+
+	// the credential was rotated during the authentication
+	if cred != r.current {
+		ao, err := clientconfig.AuthOptions(&clientconfig.ClientOpts{
+			AuthInfo: r.current.authInfo(),
+		})
+		if err == nil {
+			err = openstack.Authenticate(context.TODO(), pc, *ao)
+		}
+		if err != nil {
+			r.log.Errorf("Failed to re-authenticate a provider client using the new application credential: %v", err)
+		}
+	}
+}
+
+func (r *credentialRotator) run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if err := r.rotate(); err != nil {
+			r.log.Errorf("Failed to rotate application credential, keeping the current one: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// rotate switches to the credential stored in the Kubernetes Secret, deletes
+// the replaced credential after the grace period and rotates the current
+// credential, when it expires soon
+func (r *credentialRotator) rotate() error {
+	ctx := context.TODO()
+	secret, err := r.secrets.Get(ctx, r.secretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get %q secret: %w", r.secretName, err)
+	}
+
+	// another plugin process or Velero replica has rotated the credential
+	if stored := credentialFromSecret(secret); stored != r.credential() {
+		r.log.WithField("credentialID", stored.ID).Info("Kubernetes Secret holds a newer application credential, switching to it")
+		r.switchCredential(stored)
+	}
+
+	var pc *gophercloud.ProviderClient
+	err = Authenticate(&pc, rotationService, map[string]string{}, r.log)
+	if err != nil {
+		return err
+	}
+	identity, err := openstack.NewIdentityV3(pc, gophercloud.EndpointOpts{})
+	if err != nil {
+		return fmt.Errorf("failed to create identity client: %w", err)
+	}
+	userID, err := getUserID(pc)
+	if err != nil {
+		return err
+	}
+
+	secret, err = r.deletePreviousCredential(ctx, identity, userID, secret)
+	if err != nil || secret.Annotations[previousCredentialAnnotation] != "" {
+		// rotate again only after the replaced credential is deleted
+		return err
+	}
+
+	newCred, err := r.rotateCredential(ctx, identity, userID, secret)
+	if err != nil || newCred == nil {
+		return err
+	}
+
+	r.switchCredential(appCredential{ID: newCred.ID, Name: newCred.Name, Secret: newCred.Secret})
+
+	return nil
+}
+
+// rotateCredential creates a new application credential and stores it in
+// the Kubernetes Secret, when the current credential expires within the
+// rotateBefore period. It returns the new credential.
+func (r *credentialRotator) rotateCredential(ctx context.Context, identity *gophercloud.ServiceClient, userID string, secret *corev1.Secret) (*applicationcredentials.ApplicationCredential, error) {
+	current, err := getCurrentCredential(ctx, identity, userID, credentialFromSecret(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	logWithFields := r.log.WithFields(logrus.Fields{
+		"credentialID":   current.ID,
+		"credentialName": current.Name,
+		"expiresAt":      current.ExpiresAt,
+	})
+	if current.ExpiresAt.IsZero() {
+		logWithFields.Debug("Application credential doesn't expire, skipping the rotation")
+		return nil, nil
+	}
+	if time.Until(current.ExpiresAt) > r.rotateBefore {
+		logWithFields.Debug("Application credential doesn't expire soon, skipping the rotation")
+		return nil, nil
+	}
+
+	logWithFields.Info("Application credential expires soon, creating a new one")
+	expiresAt := time.Now().UTC().Add(r.lifetime)
+	opts := applicationcredentials.CreateOpts{
+		Name:         fmt.Sprintf("%s-%s", rotatedNameRe.ReplaceAllString(current.Name, ""), time.Now().UTC().Format("20060102150405")),
+		Description:  current.Description,
+		Unrestricted: current.Unrestricted,
+		ExpiresAt:    &expiresAt,
+	}
+	for _, role := range current.Roles {
+		opts.Roles = append(opts.Roles, applicationcredentials.Role{ID: role.ID})
+	}
+	for _, rule := range current.AccessRules {
+		opts.AccessRules = append(opts.AccessRules, applicationcredentials.AccessRule{
+			Path:    rule.Path,
+			Method:  rule.Method,
+			Service: rule.Service,
+		})
+	}
+	newCred, err := applicationcredentials.Create(ctx, identity, userID, opts).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a new application credential: %w", err)
+	}
+
+	err = r.updateSecret(ctx, secret, newCred, current.ID)
+	if err != nil {
+		// keep the working credential and remove the unused new one
+		if e := applicationcredentials.Delete(ctx, identity, userID, newCred.ID).ExtractErr(); e != nil {
+			logWithFields.Errorf("Failed to delete an unused %s application credential: %v", newCred.ID, e)
+		}
+		return nil, err
+	}
+
+	logWithFields.WithFields(logrus.Fields{
+		"newCredentialID":   newCred.ID,
+		"newCredentialName": newCred.Name,
+		"newExpiresAt":      newCred.ExpiresAt,
+	}).Info("New application credential was stored in the Kubernetes Secret")
+
+	return newCred, nil
+}
+
+// updateSecret writes the application credential into the Kubernetes Secret
+// and records the replaced credential to be deleted after the grace period.
+// The update fails, when the Secret was changed since it was read, e.g. by
+// another plugin process rotating the credential at the same time.
+func (r *credentialRotator) updateSecret(ctx context.Context, secret *corev1.Secret, cred *applicationcredentials.ApplicationCredential, previousID string) error {
+	secret = secret.DeepCopy()
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	secret.Data[appCredIDEnv] = []byte(cred.ID)
+	secret.Data[appCredSecretEnv] = []byte(cred.Secret)
+	if _, ok := secret.Data[appCredNameEnv]; ok {
+		secret.Data[appCredNameEnv] = []byte(cred.Name)
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[previousCredentialAnnotation] = previousID
+	secret.Annotations[rotatedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+
+	_, err := r.secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return fmt.Errorf("%q secret was updated concurrently: %w", r.secretName, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update %q secret: %w", r.secretName, err)
+	}
+
+	return nil
+}
+
+// deletePreviousCredential deletes the replaced application credential
+// recorded in the Kubernetes Secret, when the grace period has passed, and
+// returns the updated Secret
+func (r *credentialRotator) deletePreviousCredential(ctx context.Context, identity *gophercloud.ServiceClient, userID string, secret *corev1.Secret) (*corev1.Secret, error) {
+	previousID := secret.Annotations[previousCredentialAnnotation]
+	if previousID == "" {
+		return secret, nil
+	}
+
+	logWithFields := r.log.WithFields(logrus.Fields{
+		"credentialID": previousID,
+	})
+	rotatedAt, err := time.Parse(time.RFC3339, secret.Annotations[rotatedAtAnnotation])
+	if err != nil {
+		logWithFields.Warningf("Cannot parse the %s annotation, deleting the old application credential: %v", rotatedAtAnnotation, err)
+	} else if time.Since(rotatedAt) < r.gracePeriod {
+		logWithFields.Debug("Old application credential is deleted after the grace period")
+		return secret, nil
+	}
+
+	err = applicationcredentials.Delete(ctx, identity, userID, previousID).ExtractErr()
+	if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return secret, fmt.Errorf("failed to delete the old %s application credential: %w", previousID, err)
+	}
+
+	secret = secret.DeepCopy()
+	delete(secret.Annotations, previousCredentialAnnotation)
+	delete(secret.Annotations, rotatedAtAnnotation)
+	secret, err = r.secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update %q secret: %w", r.secretName, err)
+	}
+
+	logWithFields.Info("Old application credential was deleted")
+	return secret, nil
+}
+
+// switchCredential re-authenticates all registered provider clients using
+// the application credential
+func (r *credentialRotator) switchCredential(cred appCredential) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = cred
+
+	ao, err := clientconfig.AuthOptions(&clientconfig.ClientOpts{
+		AuthInfo: cred.authInfo(),
+	})
+	if err != nil {
+		r.log.Errorf("Failed to build auth options from the new application credential: %v", err)
+		return
+	}
+
+	var providers []weak.Pointer[gophercloud.ProviderClient]
+	for _, p := range r.providers {
+		pc := p.Value()
+		if pc == nil {
+			// provider client is not used anymore
+			continue
+		}
+		providers = append(providers, p)
+		if err := openstack.Authenticate(context.TODO(), pc, *ao); err != nil {
+			r.log.Errorf("Failed to re-authenticate a provider client using the new application credential: %v", err)
+		}
+	}
+	r.providers = providers
+
+	r.log.WithField("credentialID", cred.ID).Infof("Switched %d provider clients to the new application credential", len(providers))
+}
+
+// authInfo returns the auth info using the application credential, other
+// auth options are read from the environment variables
+func (c appCredential) authInfo() *clientconfig.AuthInfo {
+	return &clientconfig.AuthInfo{
+		ApplicationCredentialID:     c.ID,
+		ApplicationCredentialName:   c.Name,
+		ApplicationCredentialSecret: c.Secret,
+		AllowReauth:                 true,
+	}
+}
+
+// getCurrentCredential returns the application credential stored in the
+// Kubernetes Secret
+func getCurrentCredential(ctx context.Context, identity *gophercloud.ServiceClient, userID string, current appCredential) (*applicationcredentials.ApplicationCredential, error) {
+	if current.ID != "" {
+		cred, err := applicationcredentials.Get(ctx, identity, userID, current.ID).Extract()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s application credential: %w", current.ID, err)
+		}
+		return cred, nil
+	}
+
+	pages, err := applicationcredentials.List(identity, userID, applicationcredentials.ListOpts{Name: current.Name}).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list application credentials: %w", err)
+	}
+	creds, err := applicationcredentials.ExtractApplicationCredentials(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract application credentials: %w", err)
+	}
+	if len(creds) != 1 {
+		return nil, fmt.Errorf("failed to find %q application credential", current.Name)
+	}
+
+	return &creds[0], nil
+}
+
+// getUserID returns the user ID of the authenticated provider client
+func getUserID(pc *gophercloud.ProviderClient) (string, error) {
+	if r, ok := pc.GetAuthResult().(interface {
+		ExtractUser() (*tokens3.User, error)
+	}); ok {
+		user, err := r.ExtractUser()
+		if err != nil {
+			return "", fmt.Errorf("failed to extract user from the token: %w", err)
+		}
+		return user.ID, nil
+	}
+
+	return "", fmt.Errorf("application credential rotation requires Keystone v3")
+}
@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	th "github.com/gophercloud/gophercloud/v2/testhelper"
+	fakeClient "github.com/gophercloud/gophercloud/v2/testhelper/client"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	rotationUserID    = "fd786d56402c4d1691372e7dee0d00b5"
+	rotationOldCredID = "c4859fb437df4b87a51a8f5adcfb0bc7"
+	rotationNewCredID = "6b8cc7647da64166a4a3cc0c88ebbabb"
+	rotationSecret    = "velero-openstack"
+)
+
+const getApplicationCredentialResp = `{
+    "application_credential": {
+        "id": "%s",
+        "name": "velero-20240101000000",
+        "description": "velero",
+        "unrestricted": false,
+        "expires_at": "%s",
+        "roles": [{"id": "31f87923ae4a4d119aa0b85dcdbeed13", "name": "member"}],
+        "access_rules": [{"path": "/v3/**", "method": "GET", "service": "volumev3"}]
+    }
+}`
+
+const createApplicationCredentialResp = `{
+    "application_credential": {
+        "id": "%s",
+        "name": "%s",
+        "secret": "new-secret",
+        "unrestricted": false,
+        "expires_at": "%s"
+    }
+}`
+
+func handleApplicationCredentials(t *testing.T, fakeServer th.FakeServer, expiresAt time.Time, created *applicationcredentials.CreateOpts, deleted *[]string) {
+	fakeServer.Mux.HandleFunc(fmt.Sprintf("/users/%s/application_credentials/%s", rotationUserID, rotationOldCredID), func(w http.ResponseWriter, r *http.Request) {
+		th.TestHeader(t, r, "X-Auth-Token", fakeClient.TokenID)
+		switch r.Method {
+		case "GET":
+			w.Header().Add("Content-Type", "application/json")
+			fmt.Fprintf(w, getApplicationCredentialResp, rotationOldCredID, expiresAt.UTC().Format("2006-01-02T15:04:05.000000"))
+		case "DELETE":
+			*deleted = append(*deleted, rotationOldCredID)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	fakeServer.Mux.HandleFunc(fmt.Sprintf("/users/%s/application_credentials", rotationUserID), func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "POST")
+		var req struct {
+			ApplicationCredential struct {
+				Name  string `json:"name"`
+				Roles []struct {
+					ID string `json:"id"`
+				} `json:"roles"`
+				AccessRules []applicationcredentials.AccessRule `json:"access_rules"`
+			} `json:"application_credential"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		created.Name = req.ApplicationCredential.Name
+		for _, role := range req.ApplicationCredential.Roles {
+			created.Roles = append(created.Roles, applicationcredentials.Role{ID: role.ID})
+		}
+		created.AccessRules = req.ApplicationCredential.AccessRules
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, createApplicationCredentialResp, rotationNewCredID, created.Name, time.Now().Add(720*time.Hour).UTC().Format("2006-01-02T15:04:05.000000"))
+	})
+	fakeServer.Mux.HandleFunc(fmt.Sprintf("/users/%s/application_credentials/%s", rotationUserID, rotationNewCredID), func(w http.ResponseWriter, r *http.Request) {
+		th.TestMethod(t, r, "DELETE")
+		*deleted = append(*deleted, rotationNewCredID)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func TestRotateCredential(t *testing.T) {
+	tests := []struct {
+		name          string
+		expiresIn     time.Duration
+		secretExists  bool
+		conflict      bool
+		expectRotated bool
+		expectDeleted bool
+		expectError   bool
+	}{
+		{"not expiring soon", 500 * time.Hour, true, false, false, false, false},
+		{"expiring soon", 24 * time.Hour, true, false, true, false, false},
+		{"missing secret", 24 * time.Hour, false, false, false, true, true},
+		{"secret updated concurrently", 24 * time.Hour, true, true, false, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeServer := th.SetupHTTP()
+			defer fakeServer.Teardown()
+
+			var created applicationcredentials.CreateOpts
+			var deleted []string
+			handleApplicationCredentials(t, fakeServer, time.Now().Add(tt.expiresIn), &created, &deleted)
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: rotationSecret, Namespace: "velero"},
+				Data: map[string][]byte{
+					appCredIDEnv:     []byte(rotationOldCredID),
+					appCredSecretEnv: []byte("old-secret"),
+				},
+			}
+			clientset := fake.NewClientset()
+			if tt.secretExists {
+				clientset = fake.NewClientset(secret)
+			}
+			if tt.conflict {
+				// another plugin process has rotated the credential
+				clientset.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, apierrors.NewConflict(corev1.Resource("secrets"), rotationSecret, fmt.Errorf("the object has been modified"))
+				})
+			}
+
+			r := &credentialRotator{
+				log:          logrus.New(),
+				secrets:      clientset.CoreV1().Secrets("velero"),
+				secretName:   rotationSecret,
+				rotateBefore: 168 * time.Hour,
+				lifetime:     720 * time.Hour,
+			}
+
+			newCred, err := r.rotateCredential(context.TODO(), fakeClient.ServiceClient(fakeServer), rotationUserID, secret)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectDeleted, len(deleted) == 1)
+			if tt.expectDeleted {
+				assert.Equal(t, rotationNewCredID, deleted[0])
+			}
+
+			if !tt.expectRotated {
+				assert.Nil(t, newCred)
+				return
+			}
+
+			assert.Equal(t, rotationNewCredID, newCred.ID)
+			assert.Regexp(t, `^velero-\d{14}$`, created.Name)
+			assert.Equal(t, []applicationcredentials.Role{{ID: "31f87923ae4a4d119aa0b85dcdbeed13"}}, created.Roles)
+			assert.Equal(t, []applicationcredentials.AccessRule{{Path: "/v3/**", Method: "GET", Service: "volumev3"}}, created.AccessRules)
+
+			stored, err := clientset.CoreV1().Secrets("velero").Get(context.TODO(), rotationSecret, metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, rotationNewCredID, string(stored.Data[appCredIDEnv]))
+			assert.Equal(t, "new-secret", string(stored.Data[appCredSecretEnv]))
+			assert.Equal(t, rotationOldCredID, stored.Annotations[previousCredentialAnnotation])
+			assert.NotEmpty(t, stored.Annotations[rotatedAtAnnotation])
+		})
+	}
+}
+
+func TestDeletePreviousCredential(t *testing.T) {
+	tests := []struct {
+		name          string
+		rotatedAgo    time.Duration
+		expectDeleted bool
+	}{
+		{"within grace period", 30 * time.Minute, false},
+		{"after grace period", 3 * time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeServer := th.SetupHTTP()
+			defer fakeServer.Teardown()
+
+			var created applicationcredentials.CreateOpts
+			var deleted []string
+			handleApplicationCredentials(t, fakeServer, time.Now().Add(500*time.Hour), &created, &deleted)
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      rotationSecret,
+					Namespace: "velero",
+					Annotations: map[string]string{
+						previousCredentialAnnotation: rotationOldCredID,
+						rotatedAtAnnotation:          time.Now().Add(-tt.rotatedAgo).UTC().Format(time.RFC3339),
+					},
+				},
+				Data: map[string][]byte{
+					appCredIDEnv:     []byte(rotationNewCredID),
+					appCredSecretEnv: []byte("new-secret"),
+				},
+			}
+			clientset := fake.NewClientset(secret)
+
+			r := &credentialRotator{
+				log:         logrus.New(),
+				secrets:     clientset.CoreV1().Secrets("velero"),
+				secretName:  rotationSecret,
+				gracePeriod: 2 * time.Hour,
+			}
+
+			updated, err := r.deletePreviousCredential(context.TODO(), fakeClient.ServiceClient(fakeServer), rotationUserID, secret)
+			assert.NoError(t, err)
+			stored, err := clientset.CoreV1().Secrets("velero").Get(context.TODO(), rotationSecret, metav1.GetOptions{})
+			assert.NoError(t, err)
+
+			if !tt.expectDeleted {
+				assert.Empty(t, deleted)
+				assert.Equal(t, rotationOldCredID, updated.Annotations[previousCredentialAnnotation])
+				assert.Equal(t, rotationOldCredID, stored.Annotations[previousCredentialAnnotation])
+				return
+			}
+
+			assert.Equal(t, []string{rotationOldCredID}, deleted)
+			assert.NotContains(t, updated.Annotations, previousCredentialAnnotation)
+			assert.NotContains(t, stored.Annotations, previousCredentialAnnotation)
+			assert.NotContains(t, stored.Annotations, rotatedAtAnnotation)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// encryptedFrameSize is a maximal size of the plaintext encrypted in a
+	// single frame of the encrypted stream
+	encryptedFrameSize = 64 * 1024
+	// encryptedHeaderSize is a size of the frame header with the ciphertext
+	// length and the last frame flag
+	encryptedHeaderSize = 5
+)
+
+// ParseEncryptionKey parses a base64 encoded AES-256 key
+func ParseEncryptionKey(str string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("the encryption key must be 32 bytes long, got %d bytes", len(key))
+	}
+	return key, nil
+}
+
+// frameAD returns additional data authenticating the frame position, so
+// frames cannot be reordered or the stream truncated
+func frameAD(index uint64, last bool) []byte {
+	ad := make([]byte, 9)
+	binary.BigEndian.PutUint64(ad, index)
+	if last {
+		ad[8] = 1
+	}
+	return ad
+}
+
+type encryptWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+}
+
+// NewEncryptWriter returns a writer encrypting the stream using AES-256-GCM
+// in frames. Close must be called to write the last frame.
+func NewEncryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, encryptedFrameSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if len(e.buf) == encryptedFrameSize {
+			if err := e.writeFrame(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(e.buf[len(e.buf):encryptedFrameSize], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// Close writes the last frame
+func (e *encryptWriter) Close() error {
+	return e.writeFrame(true)
+}
+
+func (e *encryptWriter) writeFrame(last bool) error {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := e.aead.Seal(nonce, nonce, e.buf, frameAD(e.index, last))
+
+	header := make([]byte, encryptedHeaderSize)
+	binary.BigEndian.PutUint32(header, uint32(len(sealed)))
+	if last {
+		header[4] = 1
+	}
+	if _, err := e.w.Write(header); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+
+	e.index++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+type decryptReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+	last  bool
+}
+
+// NewDecryptReader returns a reader decrypting the stream written by the
+// encrypt writer
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, aead: aead}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.last {
+			return 0, io.EOF
+		}
+		if err := d.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) readFrame() error {
+	header := make([]byte, encryptedHeaderSize)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size < uint32(d.aead.NonceSize()+d.aead.Overhead()) || size > uint32(encryptedFrameSize+d.aead.NonceSize()+d.aead.Overhead()) {
+		return fmt.Errorf("invalid encrypted frame size %d", size)
+	}
+	last := header[4] == 1
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return err
+	}
+	nonce, ciphertext := sealed[:d.aead.NonceSize()], sealed[d.aead.NonceSize():]
+	plaintext, err := d.aead.Open(nil, nonce, ciphertext, frameAD(d.index, last))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt frame %d: %w", d.index, err)
+	}
+
+	d.index++
+	d.last = last
+	d.buf = plaintext
+	return nil
+}
+
+type progressReader struct {
+	r        io.Reader
+	read     int64
+	total    int64
+	interval time.Duration
+	last     time.Time
+	report   func(read, total int64)
+}
+
+// NewProgressReader returns a reader calling the report function with the
+// number of bytes read at most once per interval and at the end of the stream
+func NewProgressReader(r io.Reader, total int64, interval time.Duration, report func(read, total int64)) io.Reader {
+	return &progressReader{r: r, total: total, interval: interval, last: time.Now(), report: report}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if errors.Is(err, io.EOF) || time.Since(p.last) >= p.interval {
+		p.last = time.Now()
+		p.report(p.read, p.total)
+	}
+	return n, err
+}
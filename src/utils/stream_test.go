@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEncryptStream(t *testing.T) {
+	key, err := ParseEncryptionKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 1, encryptedFrameSize, 3*encryptedFrameSize + 17} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		var encrypted bytes.Buffer
+		w, err := NewEncryptWriter(&encrypted, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := NewDecryptReader(bytes.NewReader(encrypted.Bytes()), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("[%d] failed to decrypt: %v", size, err)
+		} else if !bytes.Equal(data, decrypted) {
+			t.Errorf("[%d] decrypted data doesn't match", size)
+		}
+
+		// a truncated stream must be detected
+		if size > encryptedFrameSize {
+			r, _ = NewDecryptReader(bytes.NewReader(encrypted.Bytes()[:encrypted.Len()/2]), key)
+			if _, err := io.ReadAll(r); err == nil {
+				t.Errorf("[%d] expected an error for a truncated stream", size)
+			}
+		}
+	}
+
+	if _, err := ParseEncryptionKey("c2hvcnQ="); err == nil {
+		t.Error("expected an error for a short key")
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	data := make([]byte, 1000)
+	var reports [][2]int64
+	r := NewProgressReader(bytes.NewReader(data), int64(len(data)), 0, func(read, total int64) {
+		reports = append(reports, [2]int64{read, total})
+	})
+	buf := make([]byte, 400)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			break
+		}
+	}
+
+	if len(reports) == 0 || reports[len(reports)-1] != [2]int64{1000, 1000} {
+		t.Errorf("unexpected progress reports: %v", reports)
+	}
+
+	reports = nil
+	r = NewProgressReader(bytes.NewReader(data), int64(len(data)), time.Hour, func(read, total int64) {
+		reports = append(reports, [2]int64{read, total})
+	})
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Errorf("expected a single progress report at the end, got %v", reports)
+	}
+}
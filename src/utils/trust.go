@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// TrustIDAnnotation is a PV annotation or label with a Keystone trust ID
+	// used to access the volume
+	TrustIDAnnotation = "openstack.velero.io/trust-id"
+	// ProjectIDAnnotation is a PV annotation or label with an OpenStack project
+	// ID, which is mapped to a Keystone trust ID by the "trusts" config value
+	ProjectIDAnnotation = "openstack.velero.io/project-id"
+	// trustIDSeparator separates a resource ID and a trust ID in the snapshot ID
+	trustIDSeparator = "@"
+)
+
+// GetTrustID returns a Keystone trust ID for the persistent volume. The trust
+// ID is looked up in the PV annotations and labels, then the project ID is
+// mapped to a trust ID using the trusts map. The default trust ID is returned
+// when nothing matches.
+func GetTrustID(pv *v1.PersistentVolume, trusts map[string]string, defaultTrustID string) (string, error) {
+	if v := getAnnotationOrLabel(pv, TrustIDAnnotation); v != "" {
+		return v, nil
+	}
+
+	if projectID := getAnnotationOrLabel(pv, ProjectIDAnnotation); projectID != "" {
+		if v, ok := trusts[projectID]; ok {
+			return v, nil
+		}
+		return "", fmt.Errorf("cannot find a trust ID for %q project in trusts config variable", projectID)
+	}
+
+	return defaultTrustID, nil
+}
+
+// JoinTrustID appends the trust ID to the resource ID, so the resource can
+// be accessed with the same trust-scoped token later
+func JoinTrustID(id, trustID string) string {
+	if trustID == "" {
+		return id
+	}
+	return id + trustIDSeparator + trustID
+}
+
+// SplitTrustID splits the resource ID and the trust ID
+func SplitTrustID(id string) (string, string) {
+	if i := strings.LastIndex(id, trustIDSeparator); i >= 0 {
+		return id[:i], id[i+1:]
+	}
+	return id, ""
+}
+
+// TrustCache holds trust-scoped stores and trust IDs of the volumes seen by
+// the GetVolumeID call
+type TrustCache[T any] struct {
+	mu      sync.Mutex
+	stores  map[string]T
+	volumes map[string]string
+}
+
+// SetVolumeTrustID remembers the trust ID used to access the volume
+func (c *TrustCache[T]) SetVolumeTrustID(volumeID, trustID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.volumes == nil {
+		c.volumes = make(map[string]string)
+	}
+	c.volumes[volumeID] = trustID
+}
+
+// VolumeTrustID returns the trust ID used to access the volume or the
+// fallback value
+func (c *TrustCache[T]) VolumeTrustID(volumeID, fallback string) string {
+	if c == nil {
+		return fallback
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.volumes[volumeID]; ok {
+		return v
+	}
+	return fallback
+}
+
+// GetOrCreate returns a cached trust-scoped store or creates a new one
+func (c *TrustCache[T]) GetOrCreate(trustID string, create func() (T, error)) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.stores[trustID]; ok {
+		return v, nil
+	}
+	v, err := create()
+	if err != nil {
+		return v, err
+	}
+	if c.stores == nil {
+		c.stores = make(map[string]T)
+	}
+	c.stores[trustID] = v
+	return v, nil
+}
+
+func getAnnotationOrLabel(pv *v1.PersistentVolume, key string) string {
+	if v := pv.Annotations[key]; v != "" {
+		return v
+	}
+	return pv.Labels[key]
+}
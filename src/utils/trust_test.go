@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetTrustID(t *testing.T) {
+	trusts := map[string]string{
+		"project1": "trust1",
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		labels      map[string]string
+		expected    string
+		err         bool
+	}{
+		{
+			name:     "default trust",
+			expected: "default",
+		},
+		{
+			name:        "trust from annotation",
+			annotations: map[string]string{TrustIDAnnotation: "trust2"},
+			labels:      map[string]string{ProjectIDAnnotation: "project1"},
+			expected:    "trust2",
+		},
+		{
+			name:     "trust from project label",
+			labels:   map[string]string{ProjectIDAnnotation: "project1"},
+			expected: "trust1",
+		},
+		{
+			name:        "unknown project",
+			annotations: map[string]string{ProjectIDAnnotation: "project2"},
+			err:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		pv := &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: tt.annotations,
+				Labels:      tt.labels,
+			},
+		}
+		trustID, err := GetTrustID(pv, trusts, "default")
+		if tt.err {
+			if err == nil {
+				t.Errorf("[%s] failed - expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] failed - %v", tt.name, err)
+		} else if trustID != tt.expected {
+			t.Errorf("[%s] failed - trust ID %q doesn't match expected %q", tt.name, trustID, tt.expected)
+		}
+	}
+}
+
+func TestSplitTrustID(t *testing.T) {
+	tests := map[string][2]string{
+		"d32019d3-bc6e-4319-9c1d-6722fc136a22":                                  {"d32019d3-bc6e-4319-9c1d-6722fc136a22", ""},
+		"d32019d3-bc6e-4319-9c1d-6722fc136a22@de0945a1d7c14a59bb4f3e4fb2dd5c79": {"d32019d3-bc6e-4319-9c1d-6722fc136a22", "de0945a1d7c14a59bb4f3e4fb2dd5c79"},
+	}
+
+	for id, expected := range tests {
+		resourceID, trustID := SplitTrustID(id)
+		if resourceID != expected[0] || trustID != expected[1] {
+			t.Errorf("[%s] test failed: expected %q, got %q", id, expected, []string{resourceID, trustID})
+		}
+		if v := JoinTrustID(resourceID, trustID); v != id {
+			t.Errorf("[%s] test failed: expected %q, got %q", id, id, v)
+		}
+	}
+}
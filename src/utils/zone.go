@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+var (
+	// SupportedAZFallbacks is a list of policies applied, when the
+	// requested availability zone doesn't exist:
+	//   "same" uses the availability zone of the snapshot source
+	//   "any" lets the service scheduler choose the availability zone
+	//   "fail" fails the restore
+	SupportedAZFallbacks = []string{
+		"same",
+		"any",
+		"fail",
+	}
+	// zoneTopologyKeys are well-known PV topology keys of availability zones
+	zoneTopologyKeys = []string{
+		v1.LabelTopologyZone,
+		v1.LabelFailureDomainBetaZone,
+	}
+)
+
+// ResolveAZ maps the requested availability zone using the availability zone
+// map and validates it against the available zones. The fallback policy is
+// applied, when the zone is not available. An empty zone lets the service
+// scheduler choose the availability zone.
+func ResolveAZ(az string, azMap map[string]string, zones []string, fallback, sourceAZ string) (string, error) {
+	if v, ok := azMap[az]; ok {
+		az = v
+	}
+	if az == "" || SliceContains(zones, az) {
+		return az, nil
+	}
+
+	switch fallback {
+	case "same":
+		if SliceContains(zones, sourceAZ) {
+			return sourceAZ, nil
+		}
+		return "", fmt.Errorf("%q availability zone doesn't exist and the %q snapshot source availability zone isn't available, available zones: %q", az, sourceAZ, zones)
+	case "any":
+		return "", nil
+	}
+
+	return "", fmt.Errorf("%q availability zone doesn't exist, available zones: %q", az, zones)
+}
+
+// SetPVZone sets the availability zone in the PV node affinity and labels
+// with the well-known and the provided topology keys
+func SetPVZone(pv *v1.PersistentVolume, az string, topologyKeys ...string) {
+	keys := append(append([]string{}, topologyKeys...), zoneTopologyKeys...)
+
+	for k := range pv.Labels {
+		if SliceContains(keys, k) {
+			pv.Labels[k] = az
+		}
+	}
+
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return
+	}
+	for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		for i := range term.MatchExpressions {
+			if SliceContains(keys, term.MatchExpressions[i].Key) {
+				term.MatchExpressions[i].Values = []string{az}
+			}
+		}
+	}
+}
+
+// AZCache holds availability zones of restored volumes, which differ from the
+// requested availability zone
+type AZCache struct {
+	mu      sync.Mutex
+	volumes map[string]string
+}
+
+// SetVolumeAZ remembers the availability zone of the restored volume
+func (c *AZCache) SetVolumeAZ(volumeID, az string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.volumes == nil {
+		c.volumes = make(map[string]string)
+	}
+	c.volumes[volumeID] = az
+}
+
+// VolumeAZ returns the availability zone of the restored volume or an empty
+// string, when the volume was restored into the requested availability zone
+func (c *AZCache) VolumeAZ(volumeID string) string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.volumes[volumeID]
+}
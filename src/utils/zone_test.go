@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveAZ(t *testing.T) {
+	azMap := map[string]string{"old-az1": "az1"}
+	zones := []string{"az1", "az2"}
+	tests := []struct {
+		name     string
+		az       string
+		fallback string
+		sourceAZ string
+		expected string
+		err      bool
+	}{
+		{
+			name:     "empty zone",
+			fallback: "fail",
+		},
+		{
+			name:     "existing zone",
+			az:       "az2",
+			fallback: "fail",
+			expected: "az2",
+		},
+		{
+			name:     "mapped zone",
+			az:       "old-az1",
+			fallback: "fail",
+			expected: "az1",
+		},
+		{
+			name:     "fail fallback",
+			az:       "az3",
+			fallback: "fail",
+			err:      true,
+		},
+		{
+			name:     "any fallback",
+			az:       "az3",
+			fallback: "any",
+		},
+		{
+			name:     "same fallback",
+			az:       "az3",
+			fallback: "same",
+			sourceAZ: "az2",
+			expected: "az2",
+		},
+		{
+			name:     "same fallback with unavailable source zone",
+			az:       "az3",
+			fallback: "same",
+			sourceAZ: "az4",
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		az, err := ResolveAZ(tt.az, azMap, zones, tt.fallback, tt.sourceAZ)
+		if tt.err {
+			if err == nil {
+				t.Errorf("[%s] failed - expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] failed - %v", tt.name, err)
+		} else if az != tt.expected {
+			t.Errorf("[%s] failed - zone %q doesn't match expected %q", tt.name, az, tt.expected)
+		}
+	}
+}
+
+func TestSetPVZone(t *testing.T) {
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				v1.LabelTopologyZone: "az1",
+				"app":                "test",
+			},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			NodeAffinity: &v1.VolumeNodeAffinity{
+				Required: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{
+						{
+							MatchExpressions: []v1.NodeSelectorRequirement{
+								{Key: "topology.cinder.csi.openstack.org/zone", Operator: v1.NodeSelectorOpIn, Values: []string{"az1"}},
+								{Key: "kubernetes.io/hostname", Operator: v1.NodeSelectorOpIn, Values: []string{"node1"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	SetPVZone(pv, "az2", "topology.cinder.csi.openstack.org/zone")
+
+	expectedLabels := map[string]string{v1.LabelTopologyZone: "az2", "app": "test"}
+	if !reflect.DeepEqual(pv.Labels, expectedLabels) {
+		t.Errorf("labels %v don't match expected %v", pv.Labels, expectedLabels)
+	}
+	expressions := pv.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions
+	if !reflect.DeepEqual(expressions[0].Values, []string{"az2"}) {
+		t.Errorf("zone values %v don't match expected %v", expressions[0].Values, []string{"az2"})
+	}
+	if !reflect.DeepEqual(expressions[1].Values, []string{"node1"}) {
+		t.Errorf("hostname values %v must not be changed", expressions[1].Values)
+	}
+}